@@ -0,0 +1,154 @@
+package autonats
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DocPrefix = "@nats:"
+
+var annotationRgx = regexp.MustCompile(fmt.Sprintf(`(?im)^[/*\s]*(%s([a-z0-9-_]+))(?:[ \t]+(\S+))?`, DocPrefix))
+
+type annotation struct {
+	Key   string
+	Value string
+	Pos   token.Pos // Position of the annotation in the source
+}
+
+type annotations map[string]*annotation
+
+// Parses @nats:<key> <value> annotations from comment groups
+func parseAnnotations(groups ...*ast.CommentGroup) annotations {
+	args := make(annotations)
+
+	for _, doc := range groups {
+		if doc == nil {
+			continue
+		}
+
+		for _, c := range doc.List {
+			for _, match := range annotationRgx.FindAllStringSubmatchIndex(c.Text, -1) {
+				a := &annotation{
+					Key: strings.ToLower(c.Text[match[4]:match[5]]),
+					Pos: c.Slash + token.Pos(match[2]),
+				}
+
+				if match[6] >= 0 {
+					a.Value = strings.TrimSuffix(c.Text[match[6]:match[7]], "*/")
+				}
+
+				args[a.Key] = a
+			}
+		}
+	}
+
+	return args
+}
+
+// Reports a warning for every annotation that isn't one of the known keys
+func (args annotations) checkKnown(r *Reporter, known ...string) {
+	for _, a := range args {
+		ok := false
+
+		for _, k := range known {
+			ok = ok || a.Key == k
+		}
+
+		if !ok {
+			r.Warnf(a.Pos, "unknown annotation %s%s", DocPrefix, a.Key)
+		}
+	}
+}
+
+// Returns the duration value of an annotation, or 0 if it's missing or invalid
+func (args annotations) duration(r *Reporter, key string) time.Duration {
+	a, ok := args[key]
+
+	if !ok {
+		return 0
+	}
+
+	d, err := ParseDuration(a.Value)
+
+	if err != nil {
+		r.Errorf(a.Pos, "invalid %s%s value %q: %s", DocPrefix, key, a.Value, err.Error())
+	}
+
+	return d
+}
+
+// Returns the positive integer value of an annotation, e.g. a concurrency, or 0 if it's missing or invalid
+func (args annotations) concurrency(r *Reporter, key string) int {
+	a, ok := args[key]
+
+	if !ok {
+		return 0
+	}
+
+	n, err := ParseConcurrency(a.Value)
+
+	if err != nil {
+		r.Errorf(a.Pos, "invalid %s%s value %q: %s", DocPrefix, key, a.Value, err.Error())
+	}
+
+	return n
+}
+
+// Returns whether a flag annotation is set, flags can be given an explicit true or false value
+func (args annotations) flag(r *Reporter, key string) bool {
+	a, ok := args[key]
+
+	if !ok {
+		return false
+	}
+
+	v, err := strconv.ParseBool(a.Value)
+
+	if a.Value == "" {
+		v, err = true, nil
+	}
+
+	if err != nil {
+		r.Errorf(a.Pos, "invalid %s%s value %q: must be true or false", DocPrefix, key, a.Value)
+	}
+
+	return v
+}
+
+// Parses a timeout value. Accepts Go duration strings (e.g. 750ms, 1m30s) as well as
+// whole numbers which are treated as seconds for backwards compatibility.
+func ParseDuration(value string) (time.Duration, error) {
+	var d time.Duration
+
+	if n, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(n) * time.Second
+	} else if d, err = time.ParseDuration(value); err != nil {
+		return 0, err
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive, got %s", value)
+	}
+
+	return d, nil
+}
+
+// Parses a handler concurrency value
+func ParseConcurrency(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if n <= 0 {
+		return 0, fmt.Errorf("must be positive, got %d", n)
+	}
+
+	return n, nil
+}
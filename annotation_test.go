@@ -0,0 +1,183 @@
+package autonats
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		want  time.Duration
+		err   bool
+	}{
+		{"500ms", 500 * time.Millisecond, false},
+		{"1m30s", 90 * time.Second, false},
+		{"10", 10 * time.Second, false},
+		{"0", 0, true},
+		{"-1", 0, true},
+		{"-1s", 0, true},
+		{"0s", 0, true},
+		{"soon", 0, true},
+		{"", 0, true},
+	} {
+		got, err := ParseDuration(tt.value)
+
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseDuration(%q) = %s, %v, want %s with error %t", tt.value, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestParseConcurrency(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		want  int
+		err   bool
+	}{
+		{"1", 1, false},
+		{"20", 20, false},
+		{"0", 0, true},
+		{"-3", 0, true},
+		{"1.5", 0, true},
+		{"many", 0, true},
+		{"", 0, true},
+	} {
+		got, err := ParseConcurrency(tt.value)
+
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseConcurrency(%q) = %d, %v, want %d with error %t", tt.value, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+// Method annotations take precedence over service annotations, which take precedence over the CLI
+func TestTimeoutConcurrencyPrecedence(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFiles(t, dir, map[string]string{
+		"go.mod": "module example.com/precedence\n\ngo 1.20\n",
+		"svc.go": `package svc
+
+import "context"
+
+// @nats:server Annotated
+// @nats:timeout 3s
+// @nats:concurrency 7
+type Annotated interface {
+	Inherited(ctx context.Context) error
+
+	// @nats:timeout 500ms
+	// @nats:concurrency 2
+	Overridden(ctx context.Context) error
+
+	// @nats:timeout 10
+	Seconds(ctx context.Context) error
+}
+
+// @nats:server Plain
+type Plain interface {
+	Defaults(ctx context.Context) error
+
+	// @nats:concurrency 9
+	Concurrency(ctx context.Context) error
+}
+`,
+	})
+
+	par := NewParser(&ParserConfig{DefaultTimeout: 5 * time.Second, OutputFileName: "nats_client.go", DefaultConcurrency: 4})
+
+	if err := par.ParseDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if diags := par.Run(); len(diags) > 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+
+	want := map[string]struct {
+		timeout     time.Duration
+		concurrency int
+	}{
+		"Annotated.Inherited":  {3 * time.Second, 7},
+		"Annotated.Overridden": {500 * time.Millisecond, 2},
+		"Annotated.Seconds":    {10 * time.Second, 7},
+		"Plain.Defaults":       {5 * time.Second, 4},
+		"Plain.Concurrency":    {5 * time.Second, 9},
+	}
+
+	found := 0
+
+	for _, service := range par.services {
+		for _, m := range service.Methods {
+			name := service.Name + "." + m.Name
+			w, ok := want[name]
+
+			if !ok {
+				t.Errorf("unexpected method %s", name)
+				continue
+			}
+
+			found++
+
+			if m.Timeout != w.timeout || m.HandlerConcurrency != w.concurrency {
+				t.Errorf("%s has timeout %s and concurrency %d, want %s and %d", name, m.Timeout, m.HandlerConcurrency, w.timeout, w.concurrency)
+			}
+		}
+	}
+
+	if found != len(want) {
+		t.Errorf("found %d of %d methods", found, len(want))
+	}
+}
+
+func TestInvalidAnnotationValues(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFiles(t, dir, map[string]string{
+		"go.mod": "module example.com/invalid\n\ngo 1.20\n",
+		"svc.go": `package svc
+
+import "context"
+
+// @nats:server Invalid
+// @nats:timeout 0
+type Invalid interface {
+	// @nats:timeout -1s
+	// @nats:concurrency none
+	A(ctx context.Context) error
+
+	// @nats:concurrency 0
+	B(ctx context.Context) error
+}
+`,
+	})
+
+	par := NewParser(&ParserConfig{DefaultTimeout: 5 * time.Second, OutputFileName: "nats_client.go", DefaultConcurrency: 5})
+
+	if err := par.ParseDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`svc.go:6:4: error: invalid @nats:timeout value "0": duration must be positive, got 0`,
+		`svc.go:8:5: error: invalid @nats:timeout value "-1s": duration must be positive, got -1s`,
+		`svc.go:9:5: error: invalid @nats:concurrency value "none": strconv.Atoi: parsing "none": invalid syntax`,
+		`svc.go:12:5: error: invalid @nats:concurrency value "0": must be positive, got 0`,
+	}
+
+	diags := par.Run()
+
+	if len(diags) != len(want) {
+		t.Fatalf("got %d diagnostics, want %d: %v", len(diags), len(want), diags)
+	}
+
+	for i, d := range diags {
+		d.Pos.Filename = filepath.Base(d.Pos.Filename)
+
+		if got := d.String(); got != want[i] {
+			t.Errorf("diagnostic %d is %q, want %q", i, got, want[i])
+		}
+	}
+}
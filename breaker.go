@@ -0,0 +1,324 @@
+package autonats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// State of a circuit breaker
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // Calls go through
+	BreakerOpen                         // Calls fail right away with an Unavailable error
+	BreakerHalfOpen                     // A few trial calls go through to check whether the service recovered
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+
+	return fmt.Sprintf("state(%d)", int(s))
+}
+
+// Cause of the FailedPrecondition errors returned by calls rejected by an open circuit breaker.
+// The code tells them apart from calls the service failed, and isn't retried or counted as a
+// failure by default.
+var ErrCircuitOpen = errors.New("autonats: circuit breaker is open")
+
+// Codes of the errors counted as failures by breakers that don't set FailureCodes. Other
+// errors, e.g. NotFound, mean the service is up and don't count.
+var DefaultFailureCodes = []Code{Unavailable, DeadlineExceeded, Internal, ResourceExhausted, DataLoss}
+
+// Default values of the breaker config fields that are left empty
+const (
+	DefaultBreakerWindow      = 10 * time.Second
+	DefaultBreakerMinCalls    = 20
+	DefaultBreakerErrorRate   = 0.5
+	DefaultBreakerOpenTimeout = 5 * time.Second
+	DefaultBreakerTrialCalls  = 3
+)
+
+// Receives the state changes of a breaker, named after its service, and method unless it's shared
+type BreakerStateHandler func(name string, from, to BreakerState)
+
+// Configures the circuit breakers of a client. A breaker opens once the rate of failed or slow
+// calls over the window reaches a threshold, after which calls fail right away until the open
+// timeout elapses. A few trial calls are then let through, which close the breaker if they all
+// succeed or open it again otherwise.
+type BreakerConfig struct {
+	Window        time.Duration       // Period the rates are measured over
+	MinCalls      int                 // Calls made in the window before the breaker can open
+	ErrorRate     float64             // Rate of failed calls that opens the breaker, between 0 and 1
+	SlowCall      time.Duration       // Calls taking longer are slow, the slow call rate isn't checked if 0
+	SlowCallRate  float64             // Rate of slow calls that opens the breaker, 1 by default
+	OpenTimeout   time.Duration       // Time the breaker stays open before letting trial calls through
+	TrialCalls    int                 // Trial calls made while half-open
+	FailureCodes  []Code              // Codes of the errors counted as failures, see DefaultFailureCodes
+	Shared        bool                // Whether all methods of the client share a breaker, each method has its own by default
+	OnStateChange BreakerStateHandler // Called whenever the breaker changes state, e.g. for alerting
+}
+
+// Calls are counted in buckets, so old calls leave the window gradually
+const breakerBuckets = 10
+
+type breakerBucket struct {
+	start               time.Time
+	calls, failed, slow int
+}
+
+type breaker struct {
+	name string
+	cfg  BreakerConfig
+
+	mu         sync.Mutex
+	state      BreakerState
+	generation uint64 // Incremented on every state change, so results of calls made in a previous state are ignored
+	buckets    [breakerBuckets]breakerBucket
+	openedAt   time.Time
+	trials     int // Trial calls let through while half-open
+	succeeded  int // Trial calls that succeeded
+}
+
+func newBreaker(name string, cfg BreakerConfig) *breaker {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultBreakerWindow
+	}
+
+	if cfg.MinCalls <= 0 {
+		cfg.MinCalls = DefaultBreakerMinCalls
+	}
+
+	if cfg.ErrorRate <= 0 {
+		cfg.ErrorRate = DefaultBreakerErrorRate
+	}
+
+	if cfg.SlowCallRate <= 0 {
+		cfg.SlowCallRate = 1
+	}
+
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = DefaultBreakerOpenTimeout
+	}
+
+	if cfg.TrialCalls <= 0 {
+		cfg.TrialCalls = DefaultBreakerTrialCalls
+	}
+
+	if len(cfg.FailureCodes) == 0 {
+		cfg.FailureCodes = DefaultFailureCodes
+	}
+
+	return &breaker{name: name, cfg: cfg}
+}
+
+// Returns whether a call can go through, along with the generation its result is recorded in
+func (b *breaker) allow(now time.Time) (bool, uint64) {
+	b.mu.Lock()
+
+	var from BreakerState
+
+	changed := false
+
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		from, changed = b.state, true
+		b.setState(BreakerHalfOpen)
+	}
+
+	ok := true
+
+	switch b.state {
+	case BreakerOpen:
+		ok = false
+	case BreakerHalfOpen:
+		ok = b.trials < b.cfg.TrialCalls
+
+		if ok {
+			b.trials++
+		}
+	}
+
+	generation := b.generation
+
+	b.mu.Unlock()
+
+	if changed {
+		b.notify(from, BreakerHalfOpen)
+	}
+
+	return ok, generation
+}
+
+// Records the result of a call that went through
+func (b *breaker) record(now time.Time, generation uint64, err error, d time.Duration) {
+	failed := false
+
+	for _, c := range b.cfg.FailureCodes {
+		failed = failed || (err != nil && CodeOf(err) == c)
+	}
+
+	slow := b.cfg.SlowCall > 0 && d > b.cfg.SlowCall
+
+	b.mu.Lock()
+
+	if generation != b.generation {
+		b.mu.Unlock()
+		return
+	}
+
+	// calls canceled by the caller say nothing about the service, trial calls are made again
+	if CodeOf(err) == Canceled {
+		if b.state == BreakerHalfOpen {
+			b.trials--
+		}
+
+		b.mu.Unlock()
+		return
+	}
+
+	from, to := b.state, b.state
+
+	switch b.state {
+	case BreakerClosed:
+		bucket := b.bucket(now)
+		bucket.calls++
+
+		if failed {
+			bucket.failed++
+		}
+
+		if slow {
+			bucket.slow++
+		}
+
+		if b.tripped(now) {
+			to = BreakerOpen
+		}
+
+	case BreakerHalfOpen:
+		if failed || slow {
+			to = BreakerOpen
+		} else if b.succeeded++; b.succeeded >= b.cfg.TrialCalls {
+			to = BreakerClosed
+		}
+	}
+
+	if to != from {
+		b.setState(to)
+
+		if to == BreakerOpen {
+			b.openedAt = now
+		}
+	}
+
+	b.mu.Unlock()
+
+	if to != from {
+		b.notify(from, to)
+	}
+}
+
+// Returns the bucket counting the calls made at now, resetting it if it's past the window
+func (b *breaker) bucket(now time.Time) *breakerBucket {
+	width := b.cfg.Window / breakerBuckets
+	start := now.Truncate(width)
+	bucket := &b.buckets[int(start.UnixNano()/int64(width))%breakerBuckets]
+
+	if !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+
+	return bucket
+}
+
+// Whether the calls in the window reached one of the thresholds
+func (b *breaker) tripped(now time.Time) bool {
+	var calls, failed, slow int
+
+	for _, bucket := range b.buckets {
+		if now.Sub(bucket.start) < b.cfg.Window {
+			calls += bucket.calls
+			failed += bucket.failed
+			slow += bucket.slow
+		}
+	}
+
+	if calls < b.cfg.MinCalls {
+		return false
+	}
+
+	return float64(failed)/float64(calls) >= b.cfg.ErrorRate ||
+		(b.cfg.SlowCall > 0 && float64(slow)/float64(calls) >= b.cfg.SlowCallRate)
+}
+
+// Moves to a state with empty counts, must be called with the lock held
+func (b *breaker) setState(state BreakerState) {
+	b.state = state
+	b.generation++
+	b.buckets = [breakerBuckets]breakerBucket{}
+	b.trials = 0
+	b.succeeded = 0
+}
+
+func (b *breaker) notify(from, to BreakerState) {
+	if b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(b.name, from, to)
+	}
+}
+
+// Returns an invoker going through the breaker
+func (b *breaker) invoker(invoker UnaryInvoker) UnaryInvoker {
+	if b == nil {
+		return invoker
+	}
+
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		ok, generation := b.allow(time.Now())
+
+		if !ok {
+			return nil, &Error{Code: FailedPrecondition, Message: fmt.Sprintf("autonats: circuit breaker of %s is open", b.name), cause: ErrCircuitOpen}
+		}
+
+		start := time.Now()
+		resp, err := invoker(ctx, req)
+		b.record(time.Now(), generation, err, time.Since(start))
+
+		return resp, err
+	}
+}
+
+// Returns the circuit breaker of a call, nil if the client has none
+func (o *ClientOptions) breaker(info *CallInfo) *breaker {
+	cfg, ok := o.MethodBreaker[info.Method]
+
+	if !ok {
+		cfg = o.Breaker
+	}
+
+	if cfg == nil {
+		return nil
+	}
+
+	name := info.Service
+
+	if !cfg.Shared || ok {
+		name += "." + info.Method
+	}
+
+	if b, ok := o.breakers.Load(name); ok {
+		return b.(*breaker)
+	}
+
+	b, _ := o.breakers.LoadOrStore(name, newBreaker(name, *cfg))
+
+	return b.(*breaker)
+}
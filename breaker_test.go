@@ -0,0 +1,161 @@
+package autonats
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var (
+	errUnavailable = NewError(Unavailable, "down")
+	errNotFound    = NewError(NotFound, "missing")
+	errCanceled    = WrapError(Canceled, context.Canceled)
+)
+
+// Makes a call through the breaker at now, returning whether it was let through
+func breakerCall(b *breaker, now time.Time, err error, d time.Duration) bool {
+	ok, generation := b.allow(now)
+
+	if ok {
+		b.record(now, generation, err, d)
+	}
+
+	return ok
+}
+
+func TestBreakerStates(t *testing.T) {
+	start := time.Unix(1000, 0)
+
+	var changes []string
+
+	b := newBreaker("Store.Do", BreakerConfig{
+		Window:      10 * time.Second,
+		MinCalls:    4,
+		ErrorRate:   0.5,
+		OpenTimeout: time.Second,
+		TrialCalls:  2,
+		OnStateChange: func(name string, from, to BreakerState) {
+			changes = append(changes, from.String()+" -> "+to.String())
+		},
+	})
+
+	// errors that don't mean the service is down aren't failures
+	for i := 0; i < 4; i++ {
+		breakerCall(b, start, errNotFound, 0)
+	}
+
+	// below MinCalls in the window, which now only has the failures
+	now := start.Add(11 * time.Second)
+
+	for i := 0; i < 3; i++ {
+		breakerCall(b, now, errUnavailable, 0)
+	}
+
+	if b.state != BreakerClosed {
+		t.Fatalf("breaker is %s after 3 calls, want closed", b.state)
+	}
+
+	breakerCall(b, now, nil, 0)
+
+	if b.state != BreakerOpen {
+		t.Fatalf("breaker is %s at a 75%% error rate, want open", b.state)
+	}
+
+	if breakerCall(b, now.Add(999*time.Millisecond), nil, 0) {
+		t.Fatal("open breaker let a call through")
+	}
+
+	// half-open after the timeout, with a limited number of trial calls
+	now = now.Add(time.Second)
+	ok1, gen1 := b.allow(now)
+	ok2, gen2 := b.allow(now)
+	ok3, _ := b.allow(now)
+
+	if !ok1 || !ok2 || ok3 || b.state != BreakerHalfOpen {
+		t.Fatalf("half-open breaker let through %t, %t, %t, want 2 trial calls", ok1, ok2, ok3)
+	}
+
+	// canceled trial calls free their slot
+	b.record(now, gen1, errCanceled, 0)
+
+	ok4, gen4 := b.allow(now)
+
+	if !ok4 {
+		t.Fatal("canceled trial call didn't free its slot")
+	}
+
+	b.record(now, gen2, nil, 0)
+	b.record(now, gen4, nil, 0)
+
+	if b.state != BreakerClosed {
+		t.Fatalf("breaker is %s after successful trial calls, want closed", b.state)
+	}
+
+	// a failed trial call opens the breaker again
+	for i := 0; i < 4; i++ {
+		breakerCall(b, now, errUnavailable, 0)
+	}
+
+	now = now.Add(time.Second)
+	breakerCall(b, now, errUnavailable, 0)
+
+	if b.state != BreakerOpen {
+		t.Fatalf("breaker is %s after a failed trial call, want open", b.state)
+	}
+
+	want := []string{
+		"closed -> open", "open -> half-open", "half-open -> closed",
+		"closed -> open", "open -> half-open", "half-open -> open",
+	}
+
+	if len(changes) != len(want) {
+		t.Fatalf("got state changes %v, want %v", changes, want)
+	}
+
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("state change %d is %s, want %s", i, changes[i], want[i])
+		}
+	}
+}
+
+func TestBreakerSlowCalls(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := newBreaker("Store.Do", BreakerConfig{MinCalls: 2, SlowCall: 100 * time.Millisecond, SlowCallRate: 0.5})
+
+	breakerCall(b, now, nil, 50*time.Millisecond)
+	breakerCall(b, now, nil, 200*time.Millisecond)
+
+	if b.state != BreakerOpen {
+		t.Fatalf("breaker is %s at a 50%% slow call rate, want open", b.state)
+	}
+}
+
+func TestBreakerStaleResults(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := newBreaker("Store.Do", BreakerConfig{MinCalls: 1, OpenTimeout: time.Second, TrialCalls: 1})
+
+	// a call made while closed completes after the breaker opened and went half-open
+	_, stale := b.allow(now)
+
+	breakerCall(b, now, errUnavailable, 0)
+
+	now = now.Add(time.Second)
+	ok, trial := b.allow(now)
+
+	if !ok {
+		t.Fatal("half-open breaker didn't let the trial call through")
+	}
+
+	b.record(now, stale, errUnavailable, 0)
+
+	if b.state != BreakerHalfOpen {
+		t.Fatalf("result of a call made in a previous state moved the breaker to %s", b.state)
+	}
+
+	b.record(now, trial, nil, 0)
+
+	if b.state != BreakerClosed {
+		t.Fatalf("breaker is %s after the trial call, want closed", b.state)
+	}
+}
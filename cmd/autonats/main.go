@@ -7,10 +7,94 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 var AppVersion = "0.0.1"
 
+// Value of the --tracing flag, which can be used as a boolean flag or with a tracing mode after
+// an equals sign
+type tracingFlag struct {
+	mode autonats.TracingMode
+}
+
+func (f *tracingFlag) Set(value string) error {
+	mode, err := autonats.ParseTracingMode(value)
+
+	if err != nil {
+		return err
+	}
+
+	f.mode = mode
+
+	return nil
+}
+
+func (f *tracingFlag) String() string {
+	return string(f.mode)
+}
+
+func (f *tracingFlag) IsBoolFlag() bool {
+	return true
+}
+
+// Loads and parses the packages selected by the command flags, printing diagnostics to stderr
+func parse(ctx *cli.Context, wd string, verbose bool) (*autonats.Parser, error) {
+	// e.g. --tracing otel, which sets --tracing and leaves otel as an argument
+	if ctx.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q, flag values must follow an equals sign, e.g. --tracing=otel", ctx.Args().First())
+	}
+
+	dirs := ctx.StringSlice("dir")
+	timeout, err := autonats.ParseDuration(ctx.String("timeout"))
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid timeout value: %s", err.Error())
+	}
+
+	outFile := ctx.String("out")
+	conc := ctx.Int("concurrency")
+
+	if outFile == "" {
+		outFile = "nats_client.go"
+	} else if filepath.Ext(outFile) != ".go" {
+		outFile += ".go"
+	}
+
+	if conc <= 0 {
+		conc = 5
+	}
+
+	if len(dirs) == 0 {
+		dirs = []string{wd}
+	}
+
+	if verbose {
+		fmt.Printf("parsing '%s' and will export to '%s'\n", strings.Join(dirs, "', '"), outFile)
+	}
+
+	parser := autonats.NewParser(&autonats.ParserConfig{
+		DefaultTimeout:     timeout,
+		OutputFileName:     outFile,
+		DefaultConcurrency: conc,
+		Tracing:            ctx.Generic("tracing").(*tracingFlag).mode,
+		DefaultCodec:       ctx.String("codec"),
+	})
+
+	if err := parser.ParseDir(dirs...); err != nil {
+		return nil, fmt.Errorf("failed to load packages: %s", err.Error())
+	}
+
+	diags := parser.Run()
+	printDiagnostics(diags, wd)
+
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse interfaces: %d error(s)", countErrors(diags))
+	}
+
+	return parser, nil
+}
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "Autonats"
@@ -18,80 +102,93 @@ func main() {
 
 	wd, _ := os.Getwd()
 
+	flags := []cli.Flag{
+		cli.StringSliceFlag{
+			Name:   "dir, d",
+			Usage:  "Directory or package pattern (e.g. ./...) to search for matching interfaces, can be repeated. Defaults to the current directory",
+			EnvVar: "AUTONATS_BASE_DIR",
+		},
+		cli.StringFlag{
+			Name:   "timeout, t",
+			Usage:  "Default NATS request timeout as a Go duration (e.g. 500ms, 10s) or whole seconds",
+			EnvVar: "AUTONATS_REQUEST_TIMEOUT",
+			Value:  "5s",
+		},
+		cli.StringFlag{
+			Name:   "out, o",
+			Usage:  "Name to use for output file",
+			EnvVar: "AUTONATS_OUT_FILE",
+			Value:  "nats_client.go",
+		},
+		cli.GenericFlag{
+			Name:   "tracing",
+			Usage:  "Generate tracing code, --tracing uses OpenTracing and --tracing=otel uses OpenTelemetry (the equals sign is required)",
+			EnvVar: "AUTONATS_TRACING",
+			Value:  &tracingFlag{},
+		},
+		cli.StringFlag{
+			Name:   "codec",
+			Usage:  "Default codec used to encode args and results (json, jsoniter, protobuf, msgpack, cbor)",
+			EnvVar: "AUTONATS_CODEC",
+			Value:  autonats.DefaultCodec,
+		},
+		cli.IntFlag{
+			Name:   "concurrency, c",
+			Usage:  "Default handler concurrency",
+			EnvVar: "AUTONATS_CONCURRENCY",
+			Value:  5,
+		},
+	}
+
 	app.Commands = []cli.Command{
 		{
 			Name:    "generate",
 			Aliases: []string{"g"},
 			Usage:   "Generate NATS server handler + client files",
 			Action: func(ctx *cli.Context) error {
-				baseDir := ctx.String("dir")
-				timeout := ctx.Int("timeout")
-				outFile := ctx.String("out")
-				conc := ctx.Int("concurrency")
-
-				if outFile == "" {
-					outFile = "nats_client.go"
-				} else if filepath.Ext(outFile) != ".go" {
-					outFile += ".go"
+				parser, err := parse(ctx, wd, true)
+
+				if err != nil {
+					return err
 				}
 
-				if timeout <= 0 {
-					timeout = 5
+				removed, err := parser.Render()
+
+				for _, path := range removed {
+					fmt.Printf("removed %s\n", relPath(path, wd))
 				}
 
-				if conc <= 0 {
-					conc = 5
+				return err
+			},
+			Flags: flags,
+		},
+		{
+			Name:  "check",
+			Usage: "Check that generated files are up to date, printing a diff of what generate would change",
+			Action: func(ctx *cli.Context) error {
+				parser, err := parse(ctx, wd, false)
+
+				if err != nil {
+					return err
 				}
 
-				fmt.Printf("parsing '%s' and will export to '%s'\n", baseDir, outFile)
+				stale, err := parser.Check()
 
-				parser := autonats.NewParser(&autonats.ParserConfig{
-					BaseDir:            baseDir,
-					DefaultTimeout:     timeout,
-					OutputFileName:     outFile,
-					DefaultConcurrency: conc,
-					Tracing:            ctx.Bool("tracing"),
-				})
+				if err != nil {
+					return err
+				}
 
-				if err := parser.ParseDir(baseDir); err != nil {
-					return fmt.Errorf("failed to parse the provided directory: %s", err.Error())
+				for _, f := range stale {
+					fmt.Print(f.Diff(relPath(f.Path, wd)))
 				}
 
-				parser.Run()
+				if len(stale) > 0 {
+					return fmt.Errorf("%d generated file(s) out of date, run autonats generate", len(stale))
+				}
 
-				return parser.Render()
-			},
-			Flags: []cli.Flag{
-				cli.StringFlag{
-					Name:   "dir, d",
-					Usage:  "Base directory to search for matching interfaces",
-					EnvVar: "AUTONATS_BASE_DIR",
-					Value:  wd,
-				},
-				cli.IntFlag{
-					Name:   "timeout, t",
-					Usage:  "NATS request timeout in seconds",
-					EnvVar: "AUTONATS_REQUEST_TIMEOUT",
-					Value:  5,
-				},
-				cli.StringFlag{
-					Name:   "out, o",
-					Usage:  "Name to use for output file",
-					EnvVar: "AUTONATS_OUT_FILE",
-					Value:  "nats_client.go",
-				},
-				cli.BoolFlag{
-					Name:   "tracing",
-					Usage:  "Generate tracing code using OpenTracing library",
-					EnvVar: "AUTONATS_TRACING",
-				},
-				cli.IntFlag{
-					Name:   "concurrency, c",
-					Usage:  "Default handler concurrency",
-					EnvVar: "AUTONATS_CONCURRENCY",
-					Value:  5,
-				},
+				return nil
 			},
+			Flags: flags,
 		},
 	}
 
@@ -99,3 +196,33 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// Prints diagnostics to stderr the way the Go compiler does, with paths relative to wd
+func printDiagnostics(diags autonats.Diagnostics, wd string) {
+	for _, d := range diags {
+		d.Pos.Filename = relPath(d.Pos.Filename, wd)
+
+		fmt.Fprintln(os.Stderr, d.String())
+	}
+}
+
+func countErrors(diags autonats.Diagnostics) int {
+	n := 0
+
+	for _, d := range diags {
+		if d.Severity == autonats.SeverityError {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Returns path relative to wd if it's below it
+func relPath(path, wd string) string {
+	if rel, err := filepath.Rel(wd, path); err == nil && filepath.IsAbs(path) && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+
+	return path
+}
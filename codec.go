@@ -0,0 +1,180 @@
+package autonats
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/json-iterator/go"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"reflect"
+	"sync"
+)
+
+// Encodes method args and results on the wire
+type Codec interface {
+	Name() string // Name used in @nats:codec annotations and to tag payloads
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Default codec, which is compatible with the JSON payloads of previous versions
+const DefaultCodec = "jsoniter"
+
+var (
+	codecs   = make(map[string]Codec)
+	codecsMu sync.RWMutex
+)
+
+func init() {
+	RegisterCodec(JSONCodec{})
+	RegisterCodec(JsoniterCodec{})
+	RegisterCodec(ProtobufCodec{})
+	RegisterCodec(MsgpackCodec{})
+	RegisterCodec(CBORCodec{})
+}
+
+// Registers a codec, replacing any codec with the same name
+func RegisterCodec(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	codecs[codec.Name()] = codec
+}
+
+// Returns a registered codec
+func GetCodec(name string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	if codec, ok := codecs[name]; ok {
+		return codec, nil
+	}
+
+	return nil, fmt.Errorf("autonats: unknown codec %s", name)
+}
+
+// Whether name is one of the codecs registered by this package
+func IsBuiltinCodec(name string) bool {
+	switch name {
+	case "json", "jsoniter", "protobuf", "msgpack", "cbor":
+		return true
+	}
+
+	return false
+}
+
+// Returned when a payload was encoded with a different codec than the receiver expects
+type CodecMismatchError struct {
+	Got, Want string
+}
+
+func (e *CodecMismatchError) Error() string {
+	return fmt.Sprintf("autonats: payload encoded with %s codec, expected %s", e.Got, e.Want)
+}
+
+// Encodes v with the named codec. The codec is sent in the Autonats-Codec header of requests
+// and in the frame of replies.
+func Encode(codecName string, v interface{}) ([]byte, error) {
+	codec, err := GetCodec(codecName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return codec.Marshal(v)
+}
+
+// Decodes a payload with the named codec
+func Decode(codecName string, data []byte, v interface{}) error {
+	codec, err := GetCodec(codecName)
+
+	if err != nil {
+		return err
+	}
+
+	return codec.Unmarshal(data, v)
+}
+
+// Codec using encoding/json
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string { return "json" }
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// Codec using json-iterator, compatible with encoding/json
+type JsoniterCodec struct{}
+
+func (JsoniterCodec) Name() string { return "jsoniter" }
+
+func (JsoniterCodec) Marshal(v interface{}) ([]byte, error) { return jsoniter.Marshal(v) }
+
+func (JsoniterCodec) Unmarshal(data []byte, v interface{}) error { return jsoniter.Unmarshal(data, v) }
+
+// Codec for protobuf messages, args and results must implement proto.Message
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) Name() string { return "protobuf" }
+
+func (ProtobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+
+	if !ok {
+		return nil, fmt.Errorf("autonats: protobuf codec can't encode %T, it must implement proto.Message", v)
+	}
+
+	return proto.Marshal(m)
+}
+
+func (ProtobufCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+
+	if !ok {
+		// values are decoded into a pointer to the value type, e.g. **pb.User
+		if m, ok = allocProtoMessage(v); !ok {
+			return fmt.Errorf("autonats: protobuf codec can't decode into %T, it must implement proto.Message", v)
+		}
+	}
+
+	return proto.Unmarshal(data, m)
+}
+
+// Allocates the message a pointer to a message pointer points to
+func allocProtoMessage(v interface{}) (proto.Message, bool) {
+	rv := reflect.ValueOf(v)
+
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Ptr {
+		return nil, false
+	}
+
+	elem := rv.Elem()
+
+	if elem.IsNil() {
+		elem.Set(reflect.New(elem.Type().Elem()))
+	}
+
+	m, ok := elem.Interface().(proto.Message)
+
+	return m, ok
+}
+
+// Codec using MessagePack
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) Name() string { return "msgpack" }
+
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) { return msgpack.Marshal(v) }
+
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error { return msgpack.Unmarshal(data, v) }
+
+// Codec using CBOR
+type CBORCodec struct{}
+
+func (CBORCodec) Name() string { return "cbor" }
+
+func (CBORCodec) Marshal(v interface{}) ([]byte, error) { return cbor.Marshal(v) }
+
+func (CBORCodec) Unmarshal(data []byte, v interface{}) error { return cbor.Unmarshal(data, v) }
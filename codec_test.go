@@ -0,0 +1,34 @@
+package autonats
+
+import (
+	"testing"
+)
+
+type codecTestValue struct {
+	Name string `json:"name" msgpack:"name" cbor:"name"`
+	Tags []int  `json:"tags" msgpack:"tags" cbor:"tags"`
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	in := codecTestValue{Name: "a", Tags: []int{1, 2}}
+
+	for _, name := range []string{"json", "jsoniter", "msgpack", "cbor"} {
+		t.Run(name, func(t *testing.T) {
+			data, err := Encode(name, &in)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var out codecTestValue
+
+			if err = Decode(name, data, &out); err != nil {
+				t.Fatal(err)
+			}
+
+			if out.Name != in.Name || len(out.Tags) != len(in.Tags) {
+				t.Errorf("decoded %+v, want %+v", out, in)
+			}
+		})
+	}
+}
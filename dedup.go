@@ -0,0 +1,120 @@
+package autonats
+
+import (
+	"context"
+	"github.com/nats-io/nats.go"
+	"sync"
+	"time"
+)
+
+// Stores the replies of handled calls by idempotency key, so handlers can reply to retried
+// calls without handling them again. Keys are scoped to the service and method.
+type DedupStore interface {
+	Get(ctx context.Context, key string) (reply []byte, ok bool, err error) // Returns the reply stored for key, if any
+	Put(ctx context.Context, key string, reply []byte) error                // Stores the reply of a call that succeeded
+}
+
+type dedupEntry struct {
+	reply   []byte
+	expires time.Time
+}
+
+// In-memory DedupStore keeping replies for a fixed time. Retries only hit it if they're handled
+// by the same process, so handlers running multiple replicas need a shared store.
+type MemoryDedupStore struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]dedupEntry
+	swept   time.Time
+}
+
+func NewMemoryDedupStore(ttl time.Duration) *MemoryDedupStore {
+	return &MemoryDedupStore{
+		ttl:     ttl,
+		entries: make(map[string]dedupEntry),
+		swept:   time.Now(),
+	}
+}
+
+func (s *MemoryDedupStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+
+	if !ok || time.Now().After(e.expires) {
+		return nil, false, nil
+	}
+
+	return e.reply, true, nil
+}
+
+func (s *MemoryDedupStore) Put(ctx context.Context, key string, reply []byte) error {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// expired entries are removed once per ttl, so the store doesn't grow unbounded
+	if now.Sub(s.swept) > s.ttl {
+		for k, e := range s.entries {
+			if now.After(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+
+		s.swept = now
+	}
+
+	s.entries[key] = dedupEntry{reply: reply, expires: now.Add(s.ttl)}
+
+	return nil
+}
+
+// Returns the key of a call in the dedup store, or an empty string if it has no idempotency key
+func (o *HandlerOptions) dedupKey(info *CallInfo, msg *nats.Msg) string {
+	if o == nil || o.Dedup == nil {
+		return ""
+	}
+
+	key := msg.Header.Get(HeaderIdempotencyKey)
+
+	if key == "" {
+		return ""
+	}
+
+	return info.Service + "." + info.Method + ":" + key
+}
+
+// Returns the stored reply of a call that was already handled, which is empty for methods
+// without a reply
+func (o *HandlerOptions) Replay(ctx context.Context, info *CallInfo, msg *nats.Msg) ([]byte, bool) {
+	key := o.dedupKey(info, msg)
+
+	if key == "" {
+		return nil, false
+	}
+
+	reply, ok, err := o.Dedup.Get(ctx, key)
+
+	// calls are handled again rather than failed when the store is unavailable
+	if err != nil {
+		o.logger().Printf("failed to look up %s in the dedup store: %s", key, err.Error())
+		return nil, false
+	}
+
+	return reply, ok
+}
+
+// Stores the reply sent for a call that succeeded, replyData is nil for methods without a reply
+func (o *HandlerOptions) Remember(ctx context.Context, info *CallInfo, msg *nats.Msg, replyData []byte) {
+	key := o.dedupKey(info, msg)
+
+	if key == "" {
+		return
+	}
+
+	if err := o.Dedup.Put(ctx, key, replyData); err != nil {
+		o.logger().Printf("failed to store %s in the dedup store: %s", key, err.Error())
+	}
+}
@@ -0,0 +1,132 @@
+package autonats
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+
+	return "error"
+}
+
+// Problem found while parsing interfaces, pointing at the offending source
+type Diagnostic struct {
+	Pos      token.Position
+	Severity Severity
+	Message  string
+}
+
+// Formats the diagnostic the same way the Go compiler does (file:line:col: severity: message)
+func (d *Diagnostic) String() string {
+	if !d.Pos.IsValid() && d.Pos.Filename == "" {
+		return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+	}
+
+	return fmt.Sprintf("%s: %s: %s", d.Pos, d.Severity, d.Message)
+}
+
+type Diagnostics []*Diagnostic
+
+func (ds Diagnostics) HasErrors() bool {
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Sorts diagnostics by file, line and column
+func (ds Diagnostics) Sort() {
+	sort.SliceStable(ds, func(i, j int) bool {
+		a, b := ds[i].Pos, ds[j].Pos
+
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+
+		return a.Column < b.Column
+	})
+}
+
+// Collects diagnostics, resolving positions with the file set of the package being parsed
+type Reporter struct {
+	Fset        *token.FileSet
+	Diagnostics Diagnostics
+}
+
+func (r *Reporter) report(pos token.Pos, severity Severity, format string, args ...interface{}) {
+	d := &Diagnostic{
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	}
+
+	if r.Fset != nil && pos.IsValid() {
+		d.Pos = r.Fset.Position(pos)
+	}
+
+	r.Diagnostics = append(r.Diagnostics, d)
+}
+
+func (r *Reporter) Errorf(pos token.Pos, format string, args ...interface{}) {
+	r.report(pos, SeverityError, format, args...)
+}
+
+func (r *Reporter) Warnf(pos token.Pos, format string, args ...interface{}) {
+	r.report(pos, SeverityWarning, format, args...)
+}
+
+// Converts a go/packages position (file:line:col, file:line or -) into a token.Position
+func parsePosition(pos string) token.Position {
+	var p token.Position
+
+	if pos == "" || pos == "-" {
+		return p
+	}
+
+	parts := strings.Split(pos, ":")
+	nums := make([]int, 0, 2)
+
+	// file names can contain colons, so numbers are read from the end
+	for len(parts) > 1 && len(nums) < 2 {
+		n, err := strconv.Atoi(parts[len(parts)-1])
+
+		if err != nil {
+			break
+		}
+
+		nums = append([]int{n}, nums...)
+		parts = parts[:len(parts)-1]
+	}
+
+	p.Filename = strings.Join(parts, ":")
+
+	if len(nums) > 0 {
+		p.Line = nums[0]
+	}
+
+	if len(nums) > 1 {
+		p.Column = nums[1]
+	}
+
+	return p
+}
@@ -0,0 +1,215 @@
+package autonats
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Lines of context around changes in unified diffs
+const diffContext = 3
+
+// Largest common subsequence table computed for a diff, larger changes are shown as a full replacement
+const maxDiffCells = 4 << 20
+
+type diffLine struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+// Returns a unified diff between a and b, or an empty string if they're equal
+func UnifiedDiff(oldName, newName string, a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	// line numbers in a and b before each diff line
+	oldPos := make([]int, len(lines)+1)
+	newPos := make([]int, len(lines)+1)
+
+	for i, l := range lines {
+		oldPos[i+1], newPos[i+1] = oldPos[i], newPos[i]
+
+		if l.kind != '+' {
+			oldPos[i+1]++
+		}
+
+		if l.kind != '-' {
+			newPos[i+1]++
+		}
+	}
+
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	for start := 0; start < len(lines); {
+		first := start
+
+		for first < len(lines) && lines[first].kind == ' ' {
+			first++
+		}
+
+		if first == len(lines) {
+			break
+		}
+
+		// merge changes separated by less than two contexts into one hunk
+		last := first
+
+		for {
+			next := last + 1
+
+			for next < len(lines) && lines[next].kind == ' ' {
+				next++
+			}
+
+			if next == len(lines) || next-last-1 > 2*diffContext {
+				break
+			}
+
+			last = next
+		}
+
+		from := first - diffContext
+
+		if from < start {
+			from = start
+		}
+
+		to := last + diffContext + 1
+
+		if to > len(lines) {
+			to = len(lines)
+		}
+
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(oldPos[from], oldPos[to]), hunkRange(newPos[from], newPos[to]))
+
+		for _, l := range lines[from:to] {
+			sb.WriteByte(l.kind)
+			sb.WriteString(l.text)
+
+			if !strings.HasSuffix(l.text, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		start = to
+	}
+
+	return sb.String()
+}
+
+func hunkRange(from, to int) string {
+	if to-from == 1 {
+		return fmt.Sprintf("%d", from+1)
+	}
+
+	if to == from {
+		return fmt.Sprintf("%d,0", from)
+	}
+
+	return fmt.Sprintf("%d,%d", from+1, to-from)
+}
+
+func splitLines(b []byte) []string {
+	lines := strings.SplitAfter(string(b), "\n")
+
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+func diffLines(a, b []string) []diffLine {
+	prefix := 0
+
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]diffLine, 0, len(a)+len(b))
+
+	for _, l := range a[:prefix] {
+		lines = append(lines, diffLine{' ', l})
+	}
+
+	lines = append(lines, lcsDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+
+	for _, l := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{' ', l})
+	}
+
+	return lines
+}
+
+// Diffs two lists of lines using their longest common subsequence
+func lcsDiff(a, b []string) []diffLine {
+	lines := make([]diffLine, 0, len(a)+len(b))
+
+	if len(a)*len(b) > maxDiffCells {
+		for _, l := range a {
+			lines = append(lines, diffLine{'-', l})
+		}
+
+		for _, l := range b {
+			lines = append(lines, diffLine{'+', l})
+		}
+
+		return lines
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+
+	for i < len(a) && j < len(b) {
+		if a[i] == b[j] {
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		} else if lcs[i+1][j] >= lcs[i][j+1] {
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		} else {
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{'-', a[i]})
+	}
+
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{'+', b[j]})
+	}
+
+	return lines
+}
@@ -0,0 +1,134 @@
+package autonats
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Returns the lines from..to, numbered from 1
+func numberedLines(from, to int) string {
+	var sb strings.Builder
+
+	for i := from; i <= to; i++ {
+		fmt.Fprintf(&sb, "%d\n", i)
+	}
+
+	return sb.String()
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "equal",
+			a:    "a\nb\n",
+			b:    "a\nb\n",
+			want: "",
+		},
+		{
+			name: "changed line",
+			a:    "a\nb\nc\n",
+			b:    "a\nx\nc\n",
+			want: "--- a\n+++ b\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+		},
+		{
+			name: "empty old file",
+			a:    "",
+			b:    "a\nb\n",
+			want: "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "deleted file",
+			a:    "a\nb\n",
+			b:    "",
+			want: "--- a\n+++ b\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name: "no newline at end of old file",
+			a:    "a\nb",
+			b:    "a\nb\n",
+			want: "--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			name: "no newline at end of new file",
+			a:    "a\n",
+			b:    "a\nb",
+			want: "--- a\n+++ b\n@@ -1 +1,2 @@\n a\n+b\n\\ No newline at end of file\n",
+		},
+		{
+			name: "changes within two contexts merged",
+			a:    numberedLines(1, 20),
+			b:    strings.Replace(strings.Replace(numberedLines(1, 20), "5\n", "x\n", 1), "11\n", "y\n", 1),
+			want: "--- a\n+++ b\n@@ -2,13 +2,13 @@\n 2\n 3\n 4\n-5\n+x\n 6\n 7\n 8\n 9\n 10\n-11\n+y\n 12\n 13\n 14\n",
+		},
+		{
+			name: "distant changes in separate hunks",
+			a:    numberedLines(1, 20),
+			b:    strings.Replace(strings.Replace(numberedLines(1, 20), "2\n", "x\n", 1), "19\n", "y\n", 1),
+			want: "--- a\n+++ b\n@@ -1,5 +1,5 @@\n 1\n-2\n+x\n 3\n 4\n 5\n@@ -16,5 +16,5 @@\n 16\n 17\n 18\n-19\n+y\n 20\n",
+		},
+		{
+			name: "insertion",
+			a:    "a\nc\n",
+			b:    "a\nb\nc\n",
+			want: "--- a\n+++ b\n@@ -1,2 +1,3 @@\n a\n+b\n c\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := UnifiedDiff("a", "b", []byte(tt.a), []byte(tt.b))
+
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiffLargeChange(t *testing.T) {
+	// the common subsequence table of these would have more than maxDiffCells cells
+	n := 2100
+	a := make([]string, n)
+	b := make([]string, n)
+
+	for i := range a {
+		a[i] = fmt.Sprintf("a%d\n", i)
+		b[i] = fmt.Sprintf("b%d\n", i)
+	}
+
+	// a shared line in the middle isn't kept as context by the fallback
+	a[n/2], b[n/2] = "same\n", "same\n"
+
+	if n*n <= maxDiffCells {
+		t.Fatalf("%d lines don't exceed maxDiffCells", n)
+	}
+
+	lines := diffLines(a, b)
+
+	if len(lines) != 2*n {
+		t.Fatalf("got %d diff lines, want %d", len(lines), 2*n)
+	}
+
+	for i, l := range lines {
+		want := byte('-')
+
+		if i >= n {
+			want = '+'
+		}
+
+		if l.kind != want {
+			t.Fatalf("line %d is %q, want %q", i, l.kind, want)
+		}
+	}
+
+	got := UnifiedDiff("a", "b", []byte(strings.Join(a, "")), []byte(strings.Join(b, "")))
+
+	if header := fmt.Sprintf("--- a\n+++ b\n@@ -1,%d +1,%d @@\n", n, n); !strings.HasPrefix(got, header) {
+		t.Errorf("diff starts with %q, want %q", got[:len(header)], header)
+	}
+}
@@ -0,0 +1,273 @@
+package autonats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"sync"
+)
+
+// Status code of a failed call, the set and meaning of codes matches gRPC
+type Code uint32
+
+const (
+	OK Code = iota
+	Canceled
+	Unknown
+	InvalidArgument
+	DeadlineExceeded
+	NotFound
+	AlreadyExists
+	PermissionDenied
+	ResourceExhausted
+	FailedPrecondition
+	Aborted
+	OutOfRange
+	Unimplemented
+	Internal
+	Unavailable
+	DataLoss
+	Unauthenticated
+)
+
+var codeNames = [...]string{
+	OK:                 "ok",
+	Canceled:           "canceled",
+	Unknown:            "unknown",
+	InvalidArgument:    "invalid_argument",
+	DeadlineExceeded:   "deadline_exceeded",
+	NotFound:           "not_found",
+	AlreadyExists:      "already_exists",
+	PermissionDenied:   "permission_denied",
+	ResourceExhausted:  "resource_exhausted",
+	FailedPrecondition: "failed_precondition",
+	Aborted:            "aborted",
+	OutOfRange:         "out_of_range",
+	Unimplemented:      "unimplemented",
+	Internal:           "internal",
+	Unavailable:        "unavailable",
+	DataLoss:           "data_loss",
+	Unauthenticated:    "unauthenticated",
+}
+
+func (c Code) String() string {
+	if int(c) < len(codeNames) {
+		return codeNames[c]
+	}
+
+	return fmt.Sprintf("code(%d)", uint32(c))
+}
+
+// Returns the code with the given name, e.g. not_found
+func ParseCode(name string) (Code, error) {
+	for c, n := range codeNames {
+		if n == name {
+			return Code(c), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown code %s", name)
+}
+
+// Error returned by a call, which is sent over the wire with its code and details
+type Error struct {
+	Code    Code
+	Message string
+	Details map[string]interface{} // Optional structured details, encoded as JSON on the wire
+	cause   error                  // Registered sentinel or transport error, see Unwrap
+}
+
+// Creates an error with a code
+func NewError(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Creates an error with a code and a formatted message
+func Errorf(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Wraps err with a code, keeping its message. err can still be matched with errors.Is.
+func WrapError(code Code, err error) *Error {
+	return &Error{Code: code, Message: err.Error(), cause: err}
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Code.String()
+	}
+
+	return e.Message
+}
+
+// Returns the registered sentinel or the transport error the error was created from
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Matches errors with the same code, and the same message if the target has one.
+// e.g. errors.Is(err, autonats.NewError(autonats.NotFound, ""))
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code && (t.Message == "" || t.Message == e.Message)
+}
+
+// Adds structured details to the error
+func (e *Error) WithDetails(details map[string]interface{}) *Error {
+	e.Details = details
+	return e
+}
+
+// Returns the code of an error, OK for nil and Unknown for errors without a code
+func CodeOf(err error) Code {
+	if err == nil {
+		return OK
+	}
+
+	var e *Error
+
+	if errors.As(err, &e) {
+		return e.Code
+	}
+
+	if s, ok := findSentinel(err); ok {
+		return s.code
+	}
+
+	return Unknown
+}
+
+type sentinel struct {
+	code Code
+	err  error
+}
+
+var (
+	sentinels   = make(map[string]sentinel) // by message
+	sentinelsMu sync.RWMutex
+)
+
+// Registers a sentinel error so it round-trips: when a handler returns an error matching it
+// with errors.Is, the client returns the sentinel itself, or an error wrapping it if the handler
+// added context. The message of the sentinel identifies it on the wire, so it must be unique and
+// registered by both the handler and the client.
+func RegisterError(code Code, err error) {
+	sentinelsMu.Lock()
+	defer sentinelsMu.Unlock()
+
+	sentinels[err.Error()] = sentinel{code: code, err: err}
+}
+
+func findSentinel(err error) (sentinel, bool) {
+	sentinelsMu.RLock()
+	defer sentinelsMu.RUnlock()
+
+	for _, s := range sentinels {
+		if errors.Is(err, s.err) {
+			return s, true
+		}
+	}
+
+	return sentinel{}, false
+}
+
+func lookupSentinel(id string) (sentinel, bool) {
+	sentinelsMu.RLock()
+	defer sentinelsMu.RUnlock()
+
+	s, ok := sentinels[id]
+
+	return s, ok
+}
+
+// Sets the error of a reply from an error returned by a handler
+func (r *Reply) SetError(err error) {
+	r.Code = CodeOf(err)
+	r.Error = []byte(err.Error())
+	r.ErrorID = ""
+	r.Details = nil
+
+	if s, ok := findSentinel(err); ok {
+		r.ErrorID = s.err.Error()
+	}
+
+	var e *Error
+
+	if errors.As(err, &e) && len(e.Details) > 0 {
+		r.Details, _ = json.Marshal(e.Details)
+	}
+
+	if r.Code == Unknown {
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			r.Code = DeadlineExceeded
+		case errors.Is(err, context.Canceled):
+			r.Code = Canceled
+		}
+	}
+}
+
+// Returns the error of a reply, nil if the call succeeded
+func (r *Reply) GetError() error {
+	if r.Error == nil {
+		return nil
+	}
+
+	e := &Error{Code: r.Code, Message: string(r.Error)}
+
+	if e.Code == OK {
+		// replies from previous versions have no code
+		e.Code = Unknown
+	}
+
+	if len(r.Details) > 0 {
+		_ = json.Unmarshal(r.Details, &e.Details)
+	}
+
+	if r.ErrorID != "" {
+		if s, ok := lookupSentinel(r.ErrorID); ok {
+			if e.Message == r.ErrorID && e.Details == nil {
+				return s.err
+			}
+
+			e.cause = s.err
+		}
+	}
+
+	return e
+}
+
+// Maps a payload decoding error to a coded error. Codec mismatches are reported as
+// FailedPrecondition, other errors use code.
+func DecodeError(code Code, err error) error {
+	var mismatch *CodecMismatchError
+
+	if errors.As(err, &mismatch) {
+		return WrapError(FailedPrecondition, err)
+	}
+
+	return WrapError(code, err)
+}
+
+// Maps an error from sending a request to a coded error, the original error can still be
+// matched with errors.Is
+func TransportError(err error) error {
+	var e *Error
+
+	if err == nil || errors.As(err, &e) {
+		return err
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, nats.ErrTimeout):
+		return WrapError(DeadlineExceeded, err)
+	case errors.Is(err, context.Canceled):
+		return WrapError(Canceled, err)
+	case errors.Is(err, nats.ErrNoResponders), errors.Is(err, nats.ErrConnectionClosed), errors.Is(err, nats.ErrConnectionDraining):
+		return WrapError(Unavailable, err)
+	}
+
+	return WrapError(Unknown, err)
+}
@@ -6,7 +6,13 @@ import (
 )
 
 // @nats:server Image
+// @nats:timeout 10s
 type Image interface {
 	GetByUserId(ctx context.Context, userId string) ([]*example.Image, error)
+
+	// @nats:timeout 750ms
+	// @nats:concurrency 20
 	GetCountByUserId(ctx context.Context, userId string) (int, error)
+
+	Tags(ctx context.Context, imageIds ...string) (map[string][]*example.Tag, error)
 }
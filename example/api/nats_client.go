@@ -1,10 +1,10 @@
+// Code generated by autonats. DO NOT EDIT.
+
 package api
 
 import (
 	"context"
-	"github.com/json-iterator/go"
 	"github.com/nats-io/nats.go"
-	"github.com/nats-io/not.go"
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 	"github.com/opentracing/opentracing-go/log"
@@ -13,69 +13,80 @@ import (
 	"time"
 )
 
-const timeout = time.Second * 5
-
 type ImageServer interface {
 	GetByUserId(ctx context.Context, userId string) ([]*example.Image, error)
 	GetCountByUserId(ctx context.Context, userId string) (int, error)
+	Tags(ctx context.Context, imageIds ...string) (map[string][]*example.Tag, error)
 }
 
 type imageHandler struct {
 	Server   ImageServer
 	NatsConn *nats.Conn
+	opts     *autonats.HandlerOptions
 	runners  []*autonats.Runner
 }
 
 func (h *imageHandler) Run(ctx context.Context) error {
-	h.runners = make([]*autonats.Runner, 2, 2)
+	h.runners = make([]*autonats.Runner, 3, 3)
 	tracer := opentracing.GlobalTracer()
-	if runner, err := autonats.StartRunner(ctx, h.NatsConn, "autonats.Image.GetByUserId", "autonats", 5, func(msg *nats.Msg) {
-		t := not.NewTraceMsg(msg)
-		sc, err := tracer.Extract(opentracing.Binary, t)
-		if err != nil {
+	if runner, err := h.opts.StartRunner(ctx, h.NatsConn, "autonats.Image.GetByUserId", "autonats", 5, func(msg *nats.Msg) {
+		info := &autonats.CallInfo{Service: "Image", Method: "GetByUserId", Subject: msg.Subject}
+
+		// retried calls that were already handled aren't handled again
+		if replyData, ok := h.opts.Replay(ctx, info, msg); ok {
+			_ = msg.Respond(replyData)
 			return
 		}
 
+		reply := autonats.GetReply()
+		defer autonats.PutReply(reply)
+
+		var err error
+		// messages without a valid span context, e.g. sent with a noop tracer, start a new trace
+		sc, _ := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(msg.Header))
 		replySpan := tracer.StartSpan("autonats:ImageServer:GetByUserId", ext.SpanKindRPCServer, ext.RPCServerOption(sc))
 		ext.MessageBusDestination.Set(replySpan, msg.Subject)
 		ext.Component.Set(replySpan, "autonats")
 
 		defer replySpan.Finish()
-		innerCtx, _ := context.WithTimeout(ctx, timeout)
-		innerCtxT := opentracing.ContextWithSpan(innerCtx, replySpan)
-
-		var result []*example.Image
 
-		result, err = h.Server.GetByUserId(innerCtxT, string(msg.Data))
+		innerCtx, cancelFn := autonats.ContextWithDeadline(ctx, msg, 10*time.Second)
+		defer cancelFn()
+		innerCtx = autonats.ContextFromMsg(innerCtx, msg)
+		innerCtx = opentracing.ContextWithSpan(innerCtx, replySpan)
 
-		reply := autonats.GetReply()
-		defer autonats.PutReply(reply)
+		var result interface{}
 
-		if err != nil {
-			ext.Error.Set(replySpan, true)
-			reply.Error = []byte(err.Error())
+		result, err = h.opts.Intercept(innerCtx, string(msg.Data), info, h.handleGetByUserId)
 
-		} else if result != nil {
-			if err := reply.MarshalAndSetData(result); err != nil {
-				replySpan.LogFields(log.Error(err))
-				ext.Error.Set(replySpan, true)
-				return
+		if err == nil {
+			if err = reply.Encode("jsoniter", result); err != nil {
+				err = autonats.WrapError(autonats.Internal, err)
 			}
+		}
 
+		if err != nil {
+			replySpan.LogFields(log.Error(err))
+			ext.Error.Set(replySpan, true)
+			reply.SetError(err)
 		}
 
-		replyData, err := reply.MarshalBinary()
+		replyData, marshalErr := reply.MarshalBinary()
 
-		if err != nil {
+		if marshalErr != nil {
+			err = autonats.WrapError(autonats.Internal, marshalErr)
 			replySpan.LogFields(log.Error(err))
 			ext.Error.Set(replySpan, true)
 			return
 		}
 
+		if err == nil {
+			h.opts.Remember(innerCtx, info, msg, replyData)
+		}
+
 		if err := msg.Respond(replyData); err != nil {
 			replySpan.LogFields(log.Error(err))
 			ext.Error.Set(replySpan, true)
-			return
 		}
 	}); err != nil {
 		return err
@@ -83,111 +94,284 @@ func (h *imageHandler) Run(ctx context.Context) error {
 		h.runners[0] = runner
 	}
 
-	if runner, err := autonats.StartRunner(ctx, h.NatsConn, "autonats.Image.GetCountByUserId", "autonats", 5, func(msg *nats.Msg) {
-		t := not.NewTraceMsg(msg)
-		sc, err := tracer.Extract(opentracing.Binary, t)
-		if err != nil {
+	if runner, err := h.opts.StartRunner(ctx, h.NatsConn, "autonats.Image.GetCountByUserId", "autonats", 20, func(msg *nats.Msg) {
+		info := &autonats.CallInfo{Service: "Image", Method: "GetCountByUserId", Subject: msg.Subject}
+
+		// retried calls that were already handled aren't handled again
+		if replyData, ok := h.opts.Replay(ctx, info, msg); ok {
+			_ = msg.Respond(replyData)
 			return
 		}
 
+		reply := autonats.GetReply()
+		defer autonats.PutReply(reply)
+
+		var err error
+		// messages without a valid span context, e.g. sent with a noop tracer, start a new trace
+		sc, _ := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(msg.Header))
 		replySpan := tracer.StartSpan("autonats:ImageServer:GetCountByUserId", ext.SpanKindRPCServer, ext.RPCServerOption(sc))
 		ext.MessageBusDestination.Set(replySpan, msg.Subject)
 		ext.Component.Set(replySpan, "autonats")
 
 		defer replySpan.Finish()
-		innerCtx, _ := context.WithTimeout(ctx, timeout)
-		innerCtxT := opentracing.ContextWithSpan(innerCtx, replySpan)
 
-		var result int
+		innerCtx, cancelFn := autonats.ContextWithDeadline(ctx, msg, 750*time.Millisecond)
+		defer cancelFn()
+		innerCtx = autonats.ContextFromMsg(innerCtx, msg)
+		innerCtx = opentracing.ContextWithSpan(innerCtx, replySpan)
 
-		result, err = h.Server.GetCountByUserId(innerCtxT, string(msg.Data))
+		var result interface{}
 
-		reply := autonats.GetReply()
-		defer autonats.PutReply(reply)
+		result, err = h.opts.Intercept(innerCtx, string(msg.Data), info, h.handleGetCountByUserId)
+
+		if err == nil {
+			if err = reply.Encode("jsoniter", result); err != nil {
+				err = autonats.WrapError(autonats.Internal, err)
+			}
+		}
 
 		if err != nil {
+			replySpan.LogFields(log.Error(err))
+			ext.Error.Set(replySpan, true)
+			reply.SetError(err)
+		}
+
+		replyData, marshalErr := reply.MarshalBinary()
+
+		if marshalErr != nil {
+			err = autonats.WrapError(autonats.Internal, marshalErr)
+			replySpan.LogFields(log.Error(err))
 			ext.Error.Set(replySpan, true)
-			reply.Error = []byte(err.Error())
+			return
+		}
 
-		} else if result != 0 {
-			if err := reply.MarshalAndSetData(result); err != nil {
-				replySpan.LogFields(log.Error(err))
-				ext.Error.Set(replySpan, true)
-				return
-			}
+		if err == nil {
+			h.opts.Remember(innerCtx, info, msg, replyData)
+		}
+
+		if err := msg.Respond(replyData); err != nil {
+			replySpan.LogFields(log.Error(err))
+			ext.Error.Set(replySpan, true)
+		}
+	}); err != nil {
+		_ = h.Shutdown(ctx)
+		return err
+	} else {
+		h.runners[1] = runner
+	}
 
+	if runner, err := h.opts.StartRunner(ctx, h.NatsConn, "autonats.Image.Tags", "autonats", 5, func(msg *nats.Msg) {
+		info := &autonats.CallInfo{Service: "Image", Method: "Tags", Subject: msg.Subject}
+
+		// retried calls that were already handled aren't handled again
+		if replyData, ok := h.opts.Replay(ctx, info, msg); ok {
+			_ = msg.Respond(replyData)
+			return
 		}
 
-		replyData, err := reply.MarshalBinary()
+		reply := autonats.GetReply()
+		defer autonats.PutReply(reply)
+
+		var err error
+		// messages without a valid span context, e.g. sent with a noop tracer, start a new trace
+		sc, _ := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(msg.Header))
+		replySpan := tracer.StartSpan("autonats:ImageServer:Tags", ext.SpanKindRPCServer, ext.RPCServerOption(sc))
+		ext.MessageBusDestination.Set(replySpan, msg.Subject)
+		ext.Component.Set(replySpan, "autonats")
+
+		defer replySpan.Finish()
+
+		innerCtx, cancelFn := autonats.ContextWithDeadline(ctx, msg, 10*time.Second)
+		defer cancelFn()
+		innerCtx = autonats.ContextFromMsg(innerCtx, msg)
+		innerCtx = opentracing.ContextWithSpan(innerCtx, replySpan)
+
+		var req []string
+
+		var result interface{}
+
+		if err = autonats.DecodeMsg("jsoniter", msg, &req); err != nil {
+			err = autonats.DecodeError(autonats.InvalidArgument, err)
+		} else {
+			result, err = h.opts.Intercept(innerCtx, req, info, h.handleTags)
+		}
+
+		if err == nil {
+			if err = reply.Encode("jsoniter", result); err != nil {
+				err = autonats.WrapError(autonats.Internal, err)
+			}
+		}
 
 		if err != nil {
+			replySpan.LogFields(log.Error(err))
+			ext.Error.Set(replySpan, true)
+			reply.SetError(err)
+		}
+
+		replyData, marshalErr := reply.MarshalBinary()
+
+		if marshalErr != nil {
+			err = autonats.WrapError(autonats.Internal, marshalErr)
 			replySpan.LogFields(log.Error(err))
 			ext.Error.Set(replySpan, true)
 			return
 		}
 
+		if err == nil {
+			h.opts.Remember(innerCtx, info, msg, replyData)
+		}
+
 		if err := msg.Respond(replyData); err != nil {
 			replySpan.LogFields(log.Error(err))
 			ext.Error.Set(replySpan, true)
-			return
 		}
 	}); err != nil {
-		h.Shutdown()
+		_ = h.Shutdown(ctx)
 		return err
 	} else {
-		h.runners[1] = runner
+		h.runners[2] = runner
 	}
 
 	return nil
 }
 
-func (h *imageHandler) Shutdown() {
-	for i := range h.runners {
-		if h.runners[i] != nil {
-			_ = h.runners[i].Shutdown()
-		}
-	}
+func (h *imageHandler) handleGetByUserId(ctx context.Context, req interface{}) (interface{}, error) {
+	return h.Server.GetByUserId(ctx, req.(string))
+}
+
+func (h *imageHandler) handleGetCountByUserId(ctx context.Context, req interface{}) (interface{}, error) {
+	return h.Server.GetCountByUserId(ctx, req.(string))
 }
 
-func NewImageHandler(server ImageServer, nc *nats.Conn) autonats.Handler {
+func (h *imageHandler) handleTags(ctx context.Context, req interface{}) (interface{}, error) {
+	return h.Server.Tags(ctx, req.([]string)...)
+}
+
+func (h *imageHandler) Shutdown(ctx context.Context) error {
+	return autonats.DrainRunners(ctx, h.runners...)
+}
+
+func NewImageHandler(server ImageServer, nc *nats.Conn, opts ...autonats.HandlerOption) autonats.Handler {
 	return &imageHandler{
 		Server:   server,
 		NatsConn: nc,
+		opts:     autonats.NewHandlerOptions(opts...),
 	}
 }
 
-type ImageClient struct{ NatsConn *nats.Conn }
+type ImageClient struct {
+	NatsConn *nats.Conn
+	opts     *autonats.ClientOptions
+}
 
-func NewImageClient(nc *nats.Conn) *ImageClient {
-	return &ImageClient{NatsConn: nc}
+func NewImageClient(nc *nats.Conn, opts ...autonats.ClientOption) *ImageClient {
+	return &ImageClient{
+		NatsConn: nc,
+		opts:     autonats.NewClientOptions(opts...),
+	}
 }
 
 func (client *ImageClient) GetByUserId(ctx context.Context, userId string) ([]*example.Image, error) {
+	resp, err := client.opts.Invoke(ctx, userId, &autonats.CallInfo{Service: "Image", Method: "GetByUserId", Subject: "autonats.Image.GetByUserId"}, client.invokeGetByUserId)
 
-	reqSpan, reqCtx := opentracing.StartSpanFromContext(ctx, "autonats:ImageClient:GetByUserId", ext.SpanKindRPCClient)
+	result, _ := resp.([]*example.Image)
+
+	return result, err
+}
+
+func (client *ImageClient) invokeGetByUserId(ctx context.Context, req interface{}) (interface{}, error) {
+	var err error
+
+	reqCtx, cancelFn := context.WithTimeout(ctx, 10*time.Second)
+	defer cancelFn()
+
+	reqSpan, reqCtx := opentracing.StartSpanFromContext(reqCtx, "autonats:ImageClient:GetByUserId", ext.SpanKindRPCClient)
 	ext.MessageBusDestination.Set(reqSpan, "autonats.Image.GetByUserId")
 	ext.Component.Set(reqSpan, "autonats")
 	defer reqSpan.Finish()
 
-	var t not.TraceMsg
-	var err error
+	reqMsg := autonats.NewRequestMsg(reqCtx, client.NatsConn, "autonats.Image.GetByUserId", "")
 
-	if err = opentracing.GlobalTracer().Inject(reqSpan.Context(), opentracing.Binary, &t); err != nil {
+	if err = reqSpan.Tracer().Inject(reqSpan.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(reqMsg.Header)); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
 		return nil, err
 	}
 
-	if _, err = t.Write([]byte(userId)); err != nil {
+	reqMsg.Data = []byte(req.(string))
+
+	replyMsg, err := client.NatsConn.RequestMsgWithContext(reqCtx, reqMsg)
+
+	if err != nil {
+		err = autonats.TransportError(err)
+		reqSpan.LogFields(log.Error(err))
+		ext.Error.Set(reqSpan, true)
+		return nil, err
+	}
+
+	reply := autonats.GetReply()
+	defer autonats.PutReply(reply)
+
+	if err = reply.UnmarshalBinary(replyMsg.Data); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		reqSpan.LogFields(log.Error(err))
+		ext.Error.Set(reqSpan, true)
+		return nil, err
+	}
+
+	if err = reply.GetError(); err != nil {
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
 		return nil, err
 	}
 
-	reqCtx, cancelFn := context.WithTimeout(reqCtx, timeout)
+	var result []*example.Image
+
+	if err = reply.Decode("jsoniter", &result); err != nil {
+		err = autonats.DecodeError(autonats.Internal, err)
+		reqSpan.LogFields(log.Error(err))
+		ext.Error.Set(reqSpan, true)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (client *ImageClient) GetCountByUserId(ctx context.Context, userId string) (int, error) {
+	resp, err := client.opts.Invoke(ctx, userId, &autonats.CallInfo{Service: "Image", Method: "GetCountByUserId", Subject: "autonats.Image.GetCountByUserId"}, client.invokeGetCountByUserId)
+
+	result, _ := resp.(int)
+
+	return result, err
+}
+
+func (client *ImageClient) invokeGetCountByUserId(ctx context.Context, req interface{}) (interface{}, error) {
+	var err error
+
+	reqCtx, cancelFn := context.WithTimeout(ctx, 750*time.Millisecond)
 	defer cancelFn()
-	var replyMsg *nats.Msg
-	if replyMsg, err = client.NatsConn.RequestWithContext(ctx, "autonats.Image.GetByUserId", t.Bytes()); err != nil {
+
+	reqSpan, reqCtx := opentracing.StartSpanFromContext(reqCtx, "autonats:ImageClient:GetCountByUserId", ext.SpanKindRPCClient)
+	ext.MessageBusDestination.Set(reqSpan, "autonats.Image.GetCountByUserId")
+	ext.Component.Set(reqSpan, "autonats")
+	defer reqSpan.Finish()
+
+	reqMsg := autonats.NewRequestMsg(reqCtx, client.NatsConn, "autonats.Image.GetCountByUserId", "")
+
+	if err = reqSpan.Tracer().Inject(reqSpan.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(reqMsg.Header)); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		reqSpan.LogFields(log.Error(err))
+		ext.Error.Set(reqSpan, true)
+		return nil, err
+	}
+
+	reqMsg.Data = []byte(req.(string))
+
+	replyMsg, err := client.NatsConn.RequestMsgWithContext(reqCtx, reqMsg)
+
+	if err != nil {
+		err = autonats.TransportError(err)
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
 		return nil, err
@@ -196,270 +380,649 @@ func (client *ImageClient) GetByUserId(ctx context.Context, userId string) ([]*e
 	reply := autonats.GetReply()
 	defer autonats.PutReply(reply)
 
-	if err := reply.UnmarshalBinary(replyMsg.Data); err != nil {
+	if err = reply.UnmarshalBinary(replyMsg.Data); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
 		return nil, err
 	}
 
-	if err := reply.GetError(); err != nil {
+	if err = reply.GetError(); err != nil {
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
 		return nil, err
 	}
 
-	var result []*example.Image
-	if err := reply.UnmarshalData(&result); err != nil {
+	var result int
+
+	if err = reply.Decode("jsoniter", &result); err != nil {
+		err = autonats.DecodeError(autonats.Internal, err)
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
 		return nil, err
 	}
 
 	return result, nil
+}
 
+func (client *ImageClient) Tags(ctx context.Context, imageIds ...string) (map[string][]*example.Tag, error) {
+	resp, err := client.opts.Invoke(ctx, imageIds, &autonats.CallInfo{Service: "Image", Method: "Tags", Subject: "autonats.Image.Tags"}, client.invokeTags)
+
+	result, _ := resp.(map[string][]*example.Tag)
+
+	return result, err
 }
 
-func (client *ImageClient) GetCountByUserId(ctx context.Context, userId string) (int, error) {
+func (client *ImageClient) invokeTags(ctx context.Context, req interface{}) (interface{}, error) {
+	var err error
 
-	reqSpan, reqCtx := opentracing.StartSpanFromContext(ctx, "autonats:ImageClient:GetCountByUserId", ext.SpanKindRPCClient)
-	ext.MessageBusDestination.Set(reqSpan, "autonats.Image.GetCountByUserId")
+	reqCtx, cancelFn := context.WithTimeout(ctx, 10*time.Second)
+	defer cancelFn()
+
+	reqSpan, reqCtx := opentracing.StartSpanFromContext(reqCtx, "autonats:ImageClient:Tags", ext.SpanKindRPCClient)
+	ext.MessageBusDestination.Set(reqSpan, "autonats.Image.Tags")
 	ext.Component.Set(reqSpan, "autonats")
 	defer reqSpan.Finish()
 
-	var t not.TraceMsg
-	var err error
+	reqMsg := autonats.NewRequestMsg(reqCtx, client.NatsConn, "autonats.Image.Tags", "jsoniter")
 
-	if err = opentracing.GlobalTracer().Inject(reqSpan.Context(), opentracing.Binary, &t); err != nil {
+	if err = reqSpan.Tracer().Inject(reqSpan.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(reqMsg.Header)); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
-		return 0, err
+		return nil, err
 	}
 
-	if _, err = t.Write([]byte(userId)); err != nil {
+	if reqMsg.Data, err = autonats.Encode("jsoniter", req); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
-		return 0, err
+		return nil, err
 	}
 
-	reqCtx, cancelFn := context.WithTimeout(reqCtx, timeout)
-	defer cancelFn()
-	var replyMsg *nats.Msg
-	if replyMsg, err = client.NatsConn.RequestWithContext(ctx, "autonats.Image.GetCountByUserId", t.Bytes()); err != nil {
+	replyMsg, err := client.NatsConn.RequestMsgWithContext(reqCtx, reqMsg)
+
+	if err != nil {
+		err = autonats.TransportError(err)
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
-		return 0, err
+		return nil, err
 	}
 
 	reply := autonats.GetReply()
 	defer autonats.PutReply(reply)
 
-	if err := reply.UnmarshalBinary(replyMsg.Data); err != nil {
+	if err = reply.UnmarshalBinary(replyMsg.Data); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
-		return 0, err
+		return nil, err
 	}
 
-	if err := reply.GetError(); err != nil {
+	if err = reply.GetError(); err != nil {
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
-		return 0, err
+		return nil, err
 	}
 
-	var result int
-	if err := reply.UnmarshalData(&result); err != nil {
+	var result map[string][]*example.Tag
+
+	if err = reply.Decode("jsoniter", &result); err != nil {
+		err = autonats.DecodeError(autonats.Internal, err)
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
-		return 0, err
+		return nil, err
 	}
 
 	return result, nil
-
 }
 
 type UserServer interface {
 	GetById(ctx context.Context, id []byte) (*example.User, error)
 	Create(ctx context.Context, user *example.User) error
+	Rename(ctx context.Context, id string, name string) error
+	Transfer(ctx context.Context, from string, to string, amount int64) (*example.User, error)
+	List(ctx context.Context, cursor string, limit int) ([]*example.User, string, error)
+}
+
+type userRenameRequest struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type userTransferRequest struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Amount int64  `json:"amount"`
+}
+
+type userListRequest struct {
+	Cursor string `json:"cursor"`
+	Limit  int    `json:"limit"`
+}
+
+type userListResponse struct {
+	Page       []*example.User `json:"page"`
+	NextCursor string          `json:"nextCursor"`
 }
 
 type userHandler struct {
 	Server   UserServer
 	NatsConn *nats.Conn
+	opts     *autonats.HandlerOptions
 	runners  []*autonats.Runner
 }
 
 func (h *userHandler) Run(ctx context.Context) error {
-	h.runners = make([]*autonats.Runner, 2, 2)
+	h.runners = make([]*autonats.Runner, 5, 5)
 	tracer := opentracing.GlobalTracer()
-	if runner, err := autonats.StartRunner(ctx, h.NatsConn, "autonats.User.GetById", "autonats", 5, func(msg *nats.Msg) {
-		t := not.NewTraceMsg(msg)
-		sc, err := tracer.Extract(opentracing.Binary, t)
-		if err != nil {
+	if runner, err := h.opts.StartRunner(ctx, h.NatsConn, "autonats.User.GetById", "autonats", 5, func(msg *nats.Msg) {
+		info := &autonats.CallInfo{Service: "User", Method: "GetById", Subject: msg.Subject}
+
+		// retried calls that were already handled aren't handled again
+		if replyData, ok := h.opts.Replay(ctx, info, msg); ok {
+			_ = msg.Respond(replyData)
 			return
 		}
 
+		reply := autonats.GetReply()
+		defer autonats.PutReply(reply)
+
+		var err error
+		// messages without a valid span context, e.g. sent with a noop tracer, start a new trace
+		sc, _ := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(msg.Header))
 		replySpan := tracer.StartSpan("autonats:UserServer:GetById", ext.SpanKindRPCServer, ext.RPCServerOption(sc))
 		ext.MessageBusDestination.Set(replySpan, msg.Subject)
 		ext.Component.Set(replySpan, "autonats")
 
 		defer replySpan.Finish()
-		innerCtx, _ := context.WithTimeout(ctx, timeout)
-		innerCtxT := opentracing.ContextWithSpan(innerCtx, replySpan)
 
-		var result *example.User
+		innerCtx, cancelFn := autonats.ContextWithDeadline(ctx, msg, 5*time.Second)
+		defer cancelFn()
+		innerCtx = autonats.ContextFromMsg(innerCtx, msg)
+		innerCtx = opentracing.ContextWithSpan(innerCtx, replySpan)
+
+		var req []byte
+
+		var result interface{}
+
+		if err = autonats.DecodeMsg("jsoniter", msg, &req); err != nil {
+			err = autonats.DecodeError(autonats.InvalidArgument, err)
+		} else {
+			result, err = h.opts.Intercept(innerCtx, req, info, h.handleGetById)
+		}
+
+		if err == nil {
+			if err = reply.Encode("jsoniter", result); err != nil {
+				err = autonats.WrapError(autonats.Internal, err)
+			}
+		}
+
+		if err != nil {
+			replySpan.LogFields(log.Error(err))
+			ext.Error.Set(replySpan, true)
+			reply.SetError(err)
+		}
+
+		replyData, marshalErr := reply.MarshalBinary()
+
+		if marshalErr != nil {
+			err = autonats.WrapError(autonats.Internal, marshalErr)
+			replySpan.LogFields(log.Error(err))
+			ext.Error.Set(replySpan, true)
+			return
+		}
+
+		if err == nil {
+			h.opts.Remember(innerCtx, info, msg, replyData)
+		}
 
-		var data []byte
-		if err = jsoniter.Unmarshal(msg.Data, &data); err != nil {
+		if err := msg.Respond(replyData); err != nil {
 			replySpan.LogFields(log.Error(err))
 			ext.Error.Set(replySpan, true)
+		}
+	}); err != nil {
+		return err
+	} else {
+		h.runners[0] = runner
+	}
+
+	if runner, err := h.opts.StartRunner(ctx, h.NatsConn, "autonats.User.Create", "autonats", 5, func(msg *nats.Msg) {
+		info := &autonats.CallInfo{Service: "User", Method: "Create", Subject: msg.Subject}
+
+		// retried calls that were already handled aren't handled again
+		if replyData, ok := h.opts.Replay(ctx, info, msg); ok {
+			_ = msg.Respond(replyData)
 			return
 		}
-		result, err = h.Server.GetById(innerCtxT, data)
 
 		reply := autonats.GetReply()
 		defer autonats.PutReply(reply)
 
+		var err error
+		// messages without a valid span context, e.g. sent with a noop tracer, start a new trace
+		sc, _ := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(msg.Header))
+		replySpan := tracer.StartSpan("autonats:UserServer:Create", ext.SpanKindRPCServer, ext.RPCServerOption(sc))
+		ext.MessageBusDestination.Set(replySpan, msg.Subject)
+		ext.Component.Set(replySpan, "autonats")
+
+		defer replySpan.Finish()
+
+		innerCtx, cancelFn := autonats.ContextWithDeadline(ctx, msg, 5*time.Second)
+		defer cancelFn()
+		innerCtx = autonats.ContextFromMsg(innerCtx, msg)
+		innerCtx = opentracing.ContextWithSpan(innerCtx, replySpan)
+
+		var req *example.User
+
+		if err = autonats.DecodeMsg("jsoniter", msg, &req); err != nil {
+			err = autonats.DecodeError(autonats.InvalidArgument, err)
+		} else {
+			_, err = h.opts.Intercept(innerCtx, req, info, h.handleCreate)
+		}
+
 		if err != nil {
+			replySpan.LogFields(log.Error(err))
 			ext.Error.Set(replySpan, true)
-			reply.Error = []byte(err.Error())
+			reply.SetError(err)
+		}
 
-		} else if result != nil {
-			if err := reply.MarshalAndSetData(result); err != nil {
-				replySpan.LogFields(log.Error(err))
-				ext.Error.Set(replySpan, true)
-				return
-			}
+		replyData, marshalErr := reply.MarshalBinary()
 
+		if marshalErr != nil {
+			err = autonats.WrapError(autonats.Internal, marshalErr)
+			replySpan.LogFields(log.Error(err))
+			ext.Error.Set(replySpan, true)
+			return
+		}
+
+		if err == nil {
+			h.opts.Remember(innerCtx, info, msg, replyData)
+		}
+
+		if err := msg.Respond(replyData); err != nil {
+			replySpan.LogFields(log.Error(err))
+			ext.Error.Set(replySpan, true)
 		}
+	}); err != nil {
+		_ = h.Shutdown(ctx)
+		return err
+	} else {
+		h.runners[1] = runner
+	}
 
-		replyData, err := reply.MarshalBinary()
+	if runner, err := h.opts.StartRunner(ctx, h.NatsConn, "autonats.User.Rename", "autonats", 5, func(msg *nats.Msg) {
+		info := &autonats.CallInfo{Service: "User", Method: "Rename", Subject: msg.Subject}
+
+		// retried calls that were already handled aren't handled again
+		if replyData, ok := h.opts.Replay(ctx, info, msg); ok {
+			_ = msg.Respond(replyData)
+			return
+		}
+
+		reply := autonats.GetReply()
+		defer autonats.PutReply(reply)
+
+		var err error
+		// messages without a valid span context, e.g. sent with a noop tracer, start a new trace
+		sc, _ := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(msg.Header))
+		replySpan := tracer.StartSpan("autonats:UserServer:Rename", ext.SpanKindRPCServer, ext.RPCServerOption(sc))
+		ext.MessageBusDestination.Set(replySpan, msg.Subject)
+		ext.Component.Set(replySpan, "autonats")
+
+		defer replySpan.Finish()
+
+		innerCtx, cancelFn := autonats.ContextWithDeadline(ctx, msg, 5*time.Second)
+		defer cancelFn()
+		innerCtx = autonats.ContextFromMsg(innerCtx, msg)
+		innerCtx = opentracing.ContextWithSpan(innerCtx, replySpan)
+
+		var req userRenameRequest
+
+		if err = autonats.DecodeMsg("jsoniter", msg, &req); err != nil {
+			err = autonats.DecodeError(autonats.InvalidArgument, err)
+		} else {
+			_, err = h.opts.Intercept(innerCtx, &req, info, h.handleRename)
+		}
 
 		if err != nil {
+			replySpan.LogFields(log.Error(err))
+			ext.Error.Set(replySpan, true)
+			reply.SetError(err)
+		}
+
+		replyData, marshalErr := reply.MarshalBinary()
+
+		if marshalErr != nil {
+			err = autonats.WrapError(autonats.Internal, marshalErr)
 			replySpan.LogFields(log.Error(err))
 			ext.Error.Set(replySpan, true)
 			return
 		}
 
+		if err == nil {
+			h.opts.Remember(innerCtx, info, msg, replyData)
+		}
+
 		if err := msg.Respond(replyData); err != nil {
 			replySpan.LogFields(log.Error(err))
 			ext.Error.Set(replySpan, true)
-			return
 		}
 	}); err != nil {
+		_ = h.Shutdown(ctx)
 		return err
 	} else {
-		h.runners[0] = runner
+		h.runners[2] = runner
 	}
 
-	if runner, err := autonats.StartRunner(ctx, h.NatsConn, "autonats.User.Create", "autonats", 5, func(msg *nats.Msg) {
-		t := not.NewTraceMsg(msg)
-		sc, err := tracer.Extract(opentracing.Binary, t)
-		if err != nil {
+	if runner, err := h.opts.StartRunner(ctx, h.NatsConn, "autonats.User.Transfer", "autonats", 5, func(msg *nats.Msg) {
+		info := &autonats.CallInfo{Service: "User", Method: "Transfer", Subject: msg.Subject}
+
+		// retried calls that were already handled aren't handled again
+		if replyData, ok := h.opts.Replay(ctx, info, msg); ok {
+			_ = msg.Respond(replyData)
 			return
 		}
 
-		replySpan := tracer.StartSpan("autonats:UserServer:Create", ext.SpanKindRPCServer, ext.RPCServerOption(sc))
+		reply := autonats.GetReply()
+		defer autonats.PutReply(reply)
+
+		var err error
+		// messages without a valid span context, e.g. sent with a noop tracer, start a new trace
+		sc, _ := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(msg.Header))
+		replySpan := tracer.StartSpan("autonats:UserServer:Transfer", ext.SpanKindRPCServer, ext.RPCServerOption(sc))
 		ext.MessageBusDestination.Set(replySpan, msg.Subject)
 		ext.Component.Set(replySpan, "autonats")
 
 		defer replySpan.Finish()
-		innerCtx, _ := context.WithTimeout(ctx, timeout)
-		innerCtxT := opentracing.ContextWithSpan(innerCtx, replySpan)
 
-		var data example.User
-		if err = jsoniter.Unmarshal(msg.Data, &data); err != nil {
+		innerCtx, cancelFn := autonats.ContextWithDeadline(ctx, msg, 5*time.Second)
+		defer cancelFn()
+		innerCtx = autonats.ContextFromMsg(innerCtx, msg)
+		innerCtx = opentracing.ContextWithSpan(innerCtx, replySpan)
+
+		var req userTransferRequest
+
+		var result interface{}
+
+		if err = autonats.DecodeMsg("jsoniter", msg, &req); err != nil {
+			err = autonats.DecodeError(autonats.InvalidArgument, err)
+		} else {
+			result, err = h.opts.Intercept(innerCtx, &req, info, h.handleTransfer)
+		}
+
+		if err == nil {
+			if err = reply.Encode("jsoniter", result); err != nil {
+				err = autonats.WrapError(autonats.Internal, err)
+			}
+		}
+
+		if err != nil {
+			replySpan.LogFields(log.Error(err))
+			ext.Error.Set(replySpan, true)
+			reply.SetError(err)
+		}
+
+		replyData, marshalErr := reply.MarshalBinary()
+
+		if marshalErr != nil {
+			err = autonats.WrapError(autonats.Internal, marshalErr)
+			replySpan.LogFields(log.Error(err))
+			ext.Error.Set(replySpan, true)
+			return
+		}
+
+		if err == nil {
+			h.opts.Remember(innerCtx, info, msg, replyData)
+		}
+
+		if err := msg.Respond(replyData); err != nil {
 			replySpan.LogFields(log.Error(err))
 			ext.Error.Set(replySpan, true)
+		}
+	}); err != nil {
+		_ = h.Shutdown(ctx)
+		return err
+	} else {
+		h.runners[3] = runner
+	}
+
+	if runner, err := h.opts.StartRunner(ctx, h.NatsConn, "autonats.User.List", "autonats", 5, func(msg *nats.Msg) {
+		info := &autonats.CallInfo{Service: "User", Method: "List", Subject: msg.Subject}
+
+		// retried calls that were already handled aren't handled again
+		if replyData, ok := h.opts.Replay(ctx, info, msg); ok {
+			_ = msg.Respond(replyData)
 			return
 		}
-		err = h.Server.Create(innerCtxT, &data)
 
 		reply := autonats.GetReply()
 		defer autonats.PutReply(reply)
 
-		if err != nil {
-			ext.Error.Set(replySpan, true)
-			reply.Error = []byte(err.Error())
+		var err error
+		// messages without a valid span context, e.g. sent with a noop tracer, start a new trace
+		sc, _ := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(msg.Header))
+		replySpan := tracer.StartSpan("autonats:UserServer:List", ext.SpanKindRPCServer, ext.RPCServerOption(sc))
+		ext.MessageBusDestination.Set(replySpan, msg.Subject)
+		ext.Component.Set(replySpan, "autonats")
+
+		defer replySpan.Finish()
+
+		innerCtx, cancelFn := autonats.ContextWithDeadline(ctx, msg, 5*time.Second)
+		defer cancelFn()
+		innerCtx = autonats.ContextFromMsg(innerCtx, msg)
+		innerCtx = opentracing.ContextWithSpan(innerCtx, replySpan)
+
+		var req userListRequest
+
+		var result interface{}
 
+		if err = autonats.DecodeMsg("jsoniter", msg, &req); err != nil {
+			err = autonats.DecodeError(autonats.InvalidArgument, err)
+		} else {
+			result, err = h.opts.Intercept(innerCtx, &req, info, h.handleList)
 		}
 
-		replyData, err := reply.MarshalBinary()
+		if err == nil {
+			if err = reply.Encode("jsoniter", result); err != nil {
+				err = autonats.WrapError(autonats.Internal, err)
+			}
+		}
 
 		if err != nil {
+			replySpan.LogFields(log.Error(err))
+			ext.Error.Set(replySpan, true)
+			reply.SetError(err)
+		}
+
+		replyData, marshalErr := reply.MarshalBinary()
+
+		if marshalErr != nil {
+			err = autonats.WrapError(autonats.Internal, marshalErr)
 			replySpan.LogFields(log.Error(err))
 			ext.Error.Set(replySpan, true)
 			return
 		}
 
+		if err == nil {
+			h.opts.Remember(innerCtx, info, msg, replyData)
+		}
+
 		if err := msg.Respond(replyData); err != nil {
 			replySpan.LogFields(log.Error(err))
 			ext.Error.Set(replySpan, true)
-			return
 		}
 	}); err != nil {
-		h.Shutdown()
+		_ = h.Shutdown(ctx)
 		return err
 	} else {
-		h.runners[1] = runner
+		h.runners[4] = runner
 	}
 
 	return nil
 }
 
-func (h *userHandler) Shutdown() {
-	for i := range h.runners {
-		if h.runners[i] != nil {
-			_ = h.runners[i].Shutdown()
-		}
-	}
+func (h *userHandler) handleGetById(ctx context.Context, req interface{}) (interface{}, error) {
+	return h.Server.GetById(ctx, req.([]byte))
+}
+
+func (h *userHandler) handleCreate(ctx context.Context, req interface{}) (interface{}, error) {
+	return nil, h.Server.Create(ctx, req.(*example.User))
+}
+
+func (h *userHandler) handleRename(ctx context.Context, req interface{}) (interface{}, error) {
+	r := req.(*userRenameRequest)
+	return nil, h.Server.Rename(ctx, r.Id, r.Name)
+}
+
+func (h *userHandler) handleTransfer(ctx context.Context, req interface{}) (interface{}, error) {
+	r := req.(*userTransferRequest)
+	return h.Server.Transfer(ctx, r.From, r.To, r.Amount)
+}
+
+func (h *userHandler) handleList(ctx context.Context, req interface{}) (interface{}, error) {
+	r := req.(*userListRequest)
+	var result userListResponse
+	var err error
+
+	result.Page, result.NextCursor, err = h.Server.List(ctx, r.Cursor, r.Limit)
+
+	return &result, err
 }
 
-func NewUserHandler(server UserServer, nc *nats.Conn) autonats.Handler {
+func (h *userHandler) Shutdown(ctx context.Context) error {
+	return autonats.DrainRunners(ctx, h.runners...)
+}
+
+func NewUserHandler(server UserServer, nc *nats.Conn, opts ...autonats.HandlerOption) autonats.Handler {
 	return &userHandler{
 		Server:   server,
 		NatsConn: nc,
+		opts:     autonats.NewHandlerOptions(opts...),
 	}
 }
 
-type UserClient struct{ NatsConn *nats.Conn }
+type UserClient struct {
+	NatsConn *nats.Conn
+	opts     *autonats.ClientOptions
+}
 
-func NewUserClient(nc *nats.Conn) *UserClient {
-	return &UserClient{NatsConn: nc}
+func NewUserClient(nc *nats.Conn, opts ...autonats.ClientOption) *UserClient {
+	return &UserClient{
+		NatsConn: nc,
+		opts:     autonats.NewClientOptions(opts...),
+	}
 }
 
 func (client *UserClient) GetById(ctx context.Context, id []byte) (*example.User, error) {
+	resp, err := client.opts.Invoke(ctx, id, &autonats.CallInfo{Service: "User", Method: "GetById", Subject: "autonats.User.GetById"}, client.invokeGetById)
+
+	result, _ := resp.(*example.User)
+
+	return result, err
+}
+
+func (client *UserClient) invokeGetById(ctx context.Context, req interface{}) (interface{}, error) {
+	var err error
+
+	reqCtx, cancelFn := context.WithTimeout(ctx, 5*time.Second)
+	defer cancelFn()
 
-	reqSpan, reqCtx := opentracing.StartSpanFromContext(ctx, "autonats:UserClient:GetById", ext.SpanKindRPCClient)
+	reqSpan, reqCtx := opentracing.StartSpanFromContext(reqCtx, "autonats:UserClient:GetById", ext.SpanKindRPCClient)
 	ext.MessageBusDestination.Set(reqSpan, "autonats.User.GetById")
 	ext.Component.Set(reqSpan, "autonats")
 	defer reqSpan.Finish()
 
-	var t not.TraceMsg
-	var err error
+	reqMsg := autonats.NewRequestMsg(reqCtx, client.NatsConn, "autonats.User.GetById", "jsoniter")
+
+	if err = reqSpan.Tracer().Inject(reqSpan.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(reqMsg.Header)); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		reqSpan.LogFields(log.Error(err))
+		ext.Error.Set(reqSpan, true)
+		return nil, err
+	}
 
-	if err = opentracing.GlobalTracer().Inject(reqSpan.Context(), opentracing.Binary, &t); err != nil {
+	if reqMsg.Data, err = autonats.Encode("jsoniter", req); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
 		return nil, err
 	}
 
-	var data []byte
-	data, err = jsoniter.Marshal(id)
+	replyMsg, err := client.NatsConn.RequestMsgWithContext(reqCtx, reqMsg)
+
 	if err != nil {
+		err = autonats.TransportError(err)
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
 		return nil, err
 	}
 
-	if _, err = t.Write(data); err != nil {
+	reply := autonats.GetReply()
+	defer autonats.PutReply(reply)
+
+	if err = reply.UnmarshalBinary(replyMsg.Data); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		reqSpan.LogFields(log.Error(err))
+		ext.Error.Set(reqSpan, true)
+		return nil, err
+	}
+
+	if err = reply.GetError(); err != nil {
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
 		return nil, err
 	}
 
-	reqCtx, cancelFn := context.WithTimeout(reqCtx, timeout)
+	var result *example.User
+
+	if err = reply.Decode("jsoniter", &result); err != nil {
+		err = autonats.DecodeError(autonats.Internal, err)
+		reqSpan.LogFields(log.Error(err))
+		ext.Error.Set(reqSpan, true)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (client *UserClient) Create(ctx context.Context, user *example.User) error {
+	_, err := client.opts.Invoke(ctx, user, &autonats.CallInfo{Service: "User", Method: "Create", Subject: "autonats.User.Create"}, client.invokeCreate)
+
+	return err
+}
+
+func (client *UserClient) invokeCreate(ctx context.Context, req interface{}) (interface{}, error) {
+	var err error
+
+	reqCtx, cancelFn := context.WithTimeout(ctx, 5*time.Second)
 	defer cancelFn()
-	var replyMsg *nats.Msg
-	if replyMsg, err = client.NatsConn.RequestWithContext(ctx, "autonats.User.GetById", t.Bytes()); err != nil {
+
+	reqSpan, reqCtx := opentracing.StartSpanFromContext(reqCtx, "autonats:UserClient:Create", ext.SpanKindRPCClient)
+	ext.MessageBusDestination.Set(reqSpan, "autonats.User.Create")
+	ext.Component.Set(reqSpan, "autonats")
+	defer reqSpan.Finish()
+
+	reqMsg := autonats.NewRequestMsg(reqCtx, client.NatsConn, "autonats.User.Create", "jsoniter")
+
+	if err = reqSpan.Tracer().Inject(reqSpan.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(reqMsg.Header)); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		reqSpan.LogFields(log.Error(err))
+		ext.Error.Set(reqSpan, true)
+		return nil, err
+	}
+
+	if reqMsg.Data, err = autonats.Encode("jsoniter", req); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		reqSpan.LogFields(log.Error(err))
+		ext.Error.Set(reqSpan, true)
+		return nil, err
+	}
+
+	replyMsg, err := client.NatsConn.RequestMsgWithContext(reqCtx, reqMsg)
+
+	if err != nil {
+		err = autonats.TransportError(err)
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
 		return nil, err
@@ -468,82 +1031,237 @@ func (client *UserClient) GetById(ctx context.Context, id []byte) (*example.User
 	reply := autonats.GetReply()
 	defer autonats.PutReply(reply)
 
-	if err := reply.UnmarshalBinary(replyMsg.Data); err != nil {
+	if err = reply.UnmarshalBinary(replyMsg.Data); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		reqSpan.LogFields(log.Error(err))
+		ext.Error.Set(reqSpan, true)
+		return nil, err
+	}
+
+	if err = reply.GetError(); err != nil {
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
 		return nil, err
 	}
 
-	if err := reply.GetError(); err != nil {
+	return nil, nil
+}
+
+func (client *UserClient) Rename(ctx context.Context, id string, name string) error {
+	_, err := client.opts.Invoke(ctx, &userRenameRequest{
+		Id:   id,
+		Name: name,
+	}, &autonats.CallInfo{Service: "User", Method: "Rename", Subject: "autonats.User.Rename"}, client.invokeRename)
+
+	return err
+}
+
+func (client *UserClient) invokeRename(ctx context.Context, req interface{}) (interface{}, error) {
+	var err error
+
+	reqCtx, cancelFn := context.WithTimeout(ctx, 5*time.Second)
+	defer cancelFn()
+
+	reqSpan, reqCtx := opentracing.StartSpanFromContext(reqCtx, "autonats:UserClient:Rename", ext.SpanKindRPCClient)
+	ext.MessageBusDestination.Set(reqSpan, "autonats.User.Rename")
+	ext.Component.Set(reqSpan, "autonats")
+	defer reqSpan.Finish()
+
+	reqMsg := autonats.NewRequestMsg(reqCtx, client.NatsConn, "autonats.User.Rename", "jsoniter")
+
+	if err = reqSpan.Tracer().Inject(reqSpan.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(reqMsg.Header)); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
 		return nil, err
 	}
 
-	var result example.User
-	if err := reply.UnmarshalData(&result); err != nil {
+	if reqMsg.Data, err = autonats.Encode("jsoniter", req); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
 		return nil, err
 	}
 
-	return &result, nil
+	replyMsg, err := client.NatsConn.RequestMsgWithContext(reqCtx, reqMsg)
 
+	if err != nil {
+		err = autonats.TransportError(err)
+		reqSpan.LogFields(log.Error(err))
+		ext.Error.Set(reqSpan, true)
+		return nil, err
+	}
+
+	reply := autonats.GetReply()
+	defer autonats.PutReply(reply)
+
+	if err = reply.UnmarshalBinary(replyMsg.Data); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		reqSpan.LogFields(log.Error(err))
+		ext.Error.Set(reqSpan, true)
+		return nil, err
+	}
+
+	if err = reply.GetError(); err != nil {
+		reqSpan.LogFields(log.Error(err))
+		ext.Error.Set(reqSpan, true)
+		return nil, err
+	}
+
+	return nil, nil
 }
 
-func (client *UserClient) Create(ctx context.Context, user *example.User) error {
+func (client *UserClient) Transfer(ctx context.Context, from string, to string, amount int64) (*example.User, error) {
+	resp, err := client.opts.Invoke(ctx, &userTransferRequest{
+		From:   from,
+		To:     to,
+		Amount: amount,
+	}, &autonats.CallInfo{Service: "User", Method: "Transfer", Subject: "autonats.User.Transfer"}, client.invokeTransfer)
 
-	reqSpan, reqCtx := opentracing.StartSpanFromContext(ctx, "autonats:UserClient:Create", ext.SpanKindRPCClient)
-	ext.MessageBusDestination.Set(reqSpan, "autonats.User.Create")
+	result, _ := resp.(*example.User)
+
+	return result, err
+}
+
+func (client *UserClient) invokeTransfer(ctx context.Context, req interface{}) (interface{}, error) {
+	var err error
+
+	reqCtx, cancelFn := context.WithTimeout(ctx, 5*time.Second)
+	defer cancelFn()
+
+	reqSpan, reqCtx := opentracing.StartSpanFromContext(reqCtx, "autonats:UserClient:Transfer", ext.SpanKindRPCClient)
+	ext.MessageBusDestination.Set(reqSpan, "autonats.User.Transfer")
 	ext.Component.Set(reqSpan, "autonats")
 	defer reqSpan.Finish()
 
-	var t not.TraceMsg
-	var err error
+	reqMsg := autonats.NewRequestMsg(reqCtx, client.NatsConn, "autonats.User.Transfer", "jsoniter")
 
-	if err = opentracing.GlobalTracer().Inject(reqSpan.Context(), opentracing.Binary, &t); err != nil {
+	if err = reqSpan.Tracer().Inject(reqSpan.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(reqMsg.Header)); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
-		return err
+		return nil, err
+	}
+
+	if reqMsg.Data, err = autonats.Encode("jsoniter", req); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		reqSpan.LogFields(log.Error(err))
+		ext.Error.Set(reqSpan, true)
+		return nil, err
 	}
 
-	var data []byte
-	data, err = jsoniter.Marshal(user)
+	replyMsg, err := client.NatsConn.RequestMsgWithContext(reqCtx, reqMsg)
+
 	if err != nil {
+		err = autonats.TransportError(err)
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
-		return err
+		return nil, err
+	}
+
+	reply := autonats.GetReply()
+	defer autonats.PutReply(reply)
+
+	if err = reply.UnmarshalBinary(replyMsg.Data); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		reqSpan.LogFields(log.Error(err))
+		ext.Error.Set(reqSpan, true)
+		return nil, err
 	}
 
-	if _, err = t.Write(data); err != nil {
+	if err = reply.GetError(); err != nil {
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
-		return err
+		return nil, err
+	}
+
+	var result *example.User
+
+	if err = reply.Decode("jsoniter", &result); err != nil {
+		err = autonats.DecodeError(autonats.Internal, err)
+		reqSpan.LogFields(log.Error(err))
+		ext.Error.Set(reqSpan, true)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (client *UserClient) List(ctx context.Context, cursor string, limit int) ([]*example.User, string, error) {
+	resp, err := client.opts.Invoke(ctx, &userListRequest{
+		Cursor: cursor,
+		Limit:  limit,
+	}, &autonats.CallInfo{Service: "User", Method: "List", Subject: "autonats.User.List"}, client.invokeList)
+
+	result, _ := resp.(*userListResponse)
+
+	if result == nil {
+		result = &userListResponse{}
 	}
 
-	reqCtx, cancelFn := context.WithTimeout(reqCtx, timeout)
+	return result.Page, result.NextCursor, err
+}
+
+func (client *UserClient) invokeList(ctx context.Context, req interface{}) (interface{}, error) {
+	var err error
+
+	reqCtx, cancelFn := context.WithTimeout(ctx, 5*time.Second)
 	defer cancelFn()
-	var replyMsg *nats.Msg
-	if replyMsg, err = client.NatsConn.RequestWithContext(ctx, "autonats.User.Create", t.Bytes()); err != nil {
+
+	reqSpan, reqCtx := opentracing.StartSpanFromContext(reqCtx, "autonats:UserClient:List", ext.SpanKindRPCClient)
+	ext.MessageBusDestination.Set(reqSpan, "autonats.User.List")
+	ext.Component.Set(reqSpan, "autonats")
+	defer reqSpan.Finish()
+
+	reqMsg := autonats.NewRequestMsg(reqCtx, client.NatsConn, "autonats.User.List", "jsoniter")
+
+	if err = reqSpan.Tracer().Inject(reqSpan.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(reqMsg.Header)); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
-		return err
+		return nil, err
+	}
+
+	if reqMsg.Data, err = autonats.Encode("jsoniter", req); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		reqSpan.LogFields(log.Error(err))
+		ext.Error.Set(reqSpan, true)
+		return nil, err
+	}
+
+	replyMsg, err := client.NatsConn.RequestMsgWithContext(reqCtx, reqMsg)
+
+	if err != nil {
+		err = autonats.TransportError(err)
+		reqSpan.LogFields(log.Error(err))
+		ext.Error.Set(reqSpan, true)
+		return nil, err
 	}
 
 	reply := autonats.GetReply()
 	defer autonats.PutReply(reply)
 
-	if err := reply.UnmarshalBinary(replyMsg.Data); err != nil {
+	if err = reply.UnmarshalBinary(replyMsg.Data); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
-		return err
+		return nil, err
 	}
 
-	if err := reply.GetError(); err != nil {
+	if err = reply.GetError(); err != nil {
 		reqSpan.LogFields(log.Error(err))
 		ext.Error.Set(reqSpan, true)
-		return err
+		return nil, err
 	}
 
-	return nil
+	var result userListResponse
+
+	if err = reply.Decode("jsoniter", &result); err != nil {
+		err = autonats.DecodeError(autonats.Internal, err)
+		reqSpan.LogFields(log.Error(err))
+		ext.Error.Set(reqSpan, true)
+		return nil, err
+	}
+
+	return &result, nil
 }
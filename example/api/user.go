@@ -9,4 +9,7 @@ import (
 type User interface {
 	GetById(ctx context.Context, id []byte) (*example.User, error)
 	Create(ctx context.Context, user *example.User) error
+	Rename(ctx context.Context, id, name string) error
+	Transfer(ctx context.Context, from, to string, amount int64) (*example.User, error)
+	List(ctx context.Context, cursor string, limit int) (page []*example.User, nextCursor string, err error)
 }
@@ -11,3 +11,8 @@ type Image struct {
 	Url    string `json:"url"`
 	UserId string `json:"userId"`
 }
+
+type Tag struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
@@ -0,0 +1,7 @@
+package autonats
+
+// Test helpers shared with the autonats_test package
+var (
+	RunTestServer = runTestServer
+	Eventually    = eventually
+)
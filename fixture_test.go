@@ -0,0 +1,795 @@
+package autonats_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"github.com/zyra/autonats"
+	"github.com/zyra/autonats/testdata/fixture"
+	"github.com/zyra/autonats/testdata/fixture/sub"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Implements the fixture Store, counting the calls of each method and action
+type storeServer struct {
+	mu       sync.Mutex
+	calls    map[string]int
+	started  chan struct{} // Receives a value when a blocking action starts
+	release  chan struct{} // Closed to let blocking actions return
+	record   func(string)  // Records the handler runs in interceptor tests
+	deadline time.Time     // Context deadline of the last deadline action
+}
+
+func newStoreServer() *storeServer {
+	return &storeServer{
+		calls:   make(map[string]int),
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+}
+
+func (s *storeServer) count(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls[name]++
+
+	return s.calls[name]
+}
+
+func (s *storeServer) callCount(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[name]
+}
+
+func (s *storeServer) Get(ctx context.Context, id string) (*fixture.Item, error) {
+	s.count("Get")
+
+	if s.record != nil {
+		s.record("handler")
+	}
+
+	return &fixture.Item{ID: id, Tags: []string{"a"}}, nil
+}
+
+func (s *storeServer) Put(ctx context.Context, id string, item *fixture.Item) (int, bool, error) {
+	s.count("Put")
+	return len(item.Tags), item.ID == id, nil
+}
+
+func (s *storeServer) Tag(ctx context.Context, id string, tags ...string) ([]string, error) {
+	s.count("Tag")
+	return append([]string{id}, tags...), nil
+}
+
+func (s *storeServer) Rename(ctx context.Context, id string, Id int, _name string) (string, int, error) {
+	s.count("Rename")
+	return id + " " + _name, Id, nil
+}
+
+func (s *storeServer) Label(ctx context.Context, l *sub.Label) (*sub.Label, error) {
+	s.count("Label")
+	return &sub.Label{Name: strings.ToUpper(l.Name)}, nil
+}
+
+// Actions are fail, block, panic, deadline or any other value, which is returned with its call count
+func (s *storeServer) Do(ctx context.Context, action string) (string, error) {
+	n := s.count(action)
+
+	switch action {
+	case "fail":
+		return "", autonats.NewError(autonats.Unavailable, "down")
+	case "block":
+		s.started <- struct{}{}
+		<-s.release
+	case "panic":
+		panic("boom")
+	case "deadline":
+		s.mu.Lock()
+		s.deadline, _ = ctx.Deadline()
+		s.mu.Unlock()
+	}
+
+	return fmt.Sprintf("%s %d", action, n), nil
+}
+
+func (s *storeServer) Touch(ctx context.Context, id string) error {
+	s.count("Touch")
+	return nil
+}
+
+// Starts a Store handler on an embedded server and returns a client connection
+func runStore(t *testing.T, srv *storeServer, opts ...autonats.HandlerOption) (*nats.Conn, autonats.Handler) {
+	t.Helper()
+
+	nc := autonats.RunTestServer(t, false)
+	h := fixture.NewStoreHandler(srv, nc, opts...)
+
+	if err := h.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = h.Shutdown(context.Background()) })
+
+	return nc, h
+}
+
+func TestFixtureEnvelopes(t *testing.T) {
+	nc, _ := runStore(t, newStoreServer())
+	client := fixture.NewStoreClient(nc)
+
+	version, created, err := client.Put(context.Background(), "x", &fixture.Item{ID: "x", Tags: []string{"a", "b"}})
+
+	if err != nil || version != 2 || !created {
+		t.Errorf("Put returned %d, %t, %v", version, created, err)
+	}
+}
+
+func TestFixtureEnvelopeFieldNames(t *testing.T) {
+	nc, _ := runStore(t, newStoreServer())
+	client := fixture.NewStoreClient(nc)
+
+	if old, n, err := client.Rename(context.Background(), "x", 2, "y"); err != nil || old != "x y" || n != 2 {
+		t.Errorf("Rename returned %q, %d, %v", old, n, err)
+	}
+}
+
+func TestFixtureVariadic(t *testing.T) {
+	nc, _ := runStore(t, newStoreServer())
+	client := fixture.NewStoreClient(nc)
+	ctx := context.Background()
+
+	if tags, err := client.Tag(ctx, "x", "a", "b"); err != nil || !reflect.DeepEqual(tags, []string{"x", "a", "b"}) {
+		t.Errorf("Tag returned %v, %v", tags, err)
+	}
+
+	if tags, err := client.Tag(ctx, "x"); err != nil || !reflect.DeepEqual(tags, []string{"x"}) {
+		t.Errorf("Tag without tags returned %v, %v", tags, err)
+	}
+}
+
+// The param of Label is renamed so it doesn't shadow the package of its type
+func TestFixtureShadowedPackage(t *testing.T) {
+	nc, _ := runStore(t, newStoreServer())
+	client := fixture.NewStoreClient(nc)
+
+	if l, err := client.Label(context.Background(), &sub.Label{Name: "a"}); err != nil || l.Name != "A" {
+		t.Errorf("Label returned %v, %v", l, err)
+	}
+}
+
+func TestFixtureEmbedded(t *testing.T) {
+	nc, _ := runStore(t, newStoreServer())
+	client := fixture.NewStoreClient(nc)
+
+	if item, err := client.Get(context.Background(), "x"); err != nil || item.ID != "x" {
+		t.Errorf("Get returned %v, %v", item, err)
+	}
+}
+
+func TestFixtureErrors(t *testing.T) {
+	nc, _ := runStore(t, newStoreServer())
+	client := fixture.NewStoreClient(nc)
+
+	if _, err := client.Do(context.Background(), "fail"); autonats.CodeOf(err) != autonats.Unavailable || err.Error() != "down" {
+		t.Errorf("Do returned %v with code %s", err, autonats.CodeOf(err))
+	}
+}
+
+func TestFixtureInterceptorOrder(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls = append(calls, name)
+	}
+
+	client := func(name string) autonats.UnaryClientInterceptor {
+		return func(ctx context.Context, req interface{}, info *autonats.CallInfo, invoker autonats.UnaryInvoker) (interface{}, error) {
+			record(name + " before")
+			defer record(name + " after")
+			return invoker(ctx, req)
+		}
+	}
+
+	server := func(name string) autonats.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, info *autonats.CallInfo, handler autonats.UnaryHandler) (interface{}, error) {
+			record(name + " before")
+			defer record(name + " after")
+			return handler(ctx, req)
+		}
+	}
+
+	srv := newStoreServer()
+	srv.record = record
+	nc, _ := runStore(t, srv, autonats.WithServerInterceptors(server("server1"), server("server2")))
+
+	c := fixture.NewStoreClient(nc, autonats.WithClientInterceptors(client("client1"), client("client2")))
+
+	if _, err := c.Get(context.Background(), "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"client1 before", "client2 before",
+		"server1 before", "server2 before",
+		"handler",
+		"server2 after", "server1 after",
+		"client2 after", "client1 after",
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("got calls %v, want %v", calls, want)
+	}
+}
+
+func TestFixturePanic(t *testing.T) {
+	srv := newStoreServer()
+	nc, _ := runStore(t, srv, autonats.WithLogger(log.New(io.Discard, "", 0)))
+	client := fixture.NewStoreClient(nc)
+	recovered := autonats.RecoveredPanics()
+
+	_, err := client.Do(context.Background(), "panic")
+
+	var e *autonats.Error
+
+	if !errors.As(err, &e) || e.Code != autonats.Internal {
+		t.Fatalf("got %v, want an Internal error", err)
+	}
+
+	if id, _ := e.Details["correlation_id"].(string); id == "" || !strings.Contains(e.Message, id) {
+		t.Errorf("error %q has correlation ID %q", e.Message, id)
+	}
+
+	if n := autonats.RecoveredPanics() - recovered; n != 1 {
+		t.Errorf("recovered %d panics, want 1", n)
+	}
+
+	// the worker recovered, so the handler keeps serving
+	if res, err := client.Do(context.Background(), "ok"); err != nil || res != "ok 1" {
+		t.Errorf("call after the panic returned %q, %v", res, err)
+	}
+}
+
+// Runs itself in a subprocess, which the panic should crash
+func TestFixtureRepanic(t *testing.T) {
+	if os.Getenv("AUTONATS_TEST_REPANIC") == "1" {
+		nc, _ := runStore(t, newStoreServer(), autonats.WithRepanic(), autonats.WithLogger(log.New(io.Discard, "", 0)))
+		_, _ = fixture.NewStoreClient(nc).Do(context.Background(), "panic")
+
+		time.Sleep(5 * time.Second)
+		t.Fatal("handler didn't panic again")
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestFixtureRepanic$")
+	cmd.Env = append(os.Environ(), "AUTONATS_TEST_REPANIC=1")
+	out, err := cmd.CombinedOutput()
+
+	if err == nil || !strings.Contains(string(out), "panic: boom") {
+		t.Fatalf("got %v, want the process to panic:\n%s", err, out)
+	}
+}
+
+func TestFixtureDrain(t *testing.T) {
+	srv := newStoreServer()
+	nc, h := runStore(t, srv)
+	client := fixture.NewStoreClient(nc)
+
+	type result struct {
+		res string
+		err error
+	}
+
+	results := make(chan result, 1)
+
+	go func() {
+		res, err := client.Do(context.Background(), "block")
+		results <- result{res, err}
+	}()
+
+	<-srv.started
+
+	drained := make(chan error, 1)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		drained <- h.Shutdown(ctx)
+	}()
+
+	// the in-flight call holds up the drain
+	select {
+	case err := <-drained:
+		t.Fatalf("drain returned %v before the in-flight call completed", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(srv.release)
+
+	if r := <-results; r.err != nil || r.res != "block 1" {
+		t.Errorf("in-flight call returned %q, %v", r.res, r.err)
+	}
+
+	if err := <-drained; err != nil {
+		t.Errorf("drain failed: %s", err.Error())
+	}
+
+	if _, err := client.Do(context.Background(), "after"); autonats.CodeOf(err) != autonats.Unavailable {
+		t.Errorf("call after the drain returned %v, want an Unavailable error", err)
+	}
+}
+
+// Handler contexts end at the client deadline or after the method timeout, whichever comes first
+func TestFixtureDeadline(t *testing.T) {
+	srv := newStoreServer()
+	nc, _ := runStore(t, srv)
+	client := fixture.NewStoreClient(nc)
+
+	lastDeadline := func() time.Time {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+
+		return srv.deadline
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	clientDeadline, _ := ctx.Deadline()
+
+	if _, err := client.Do(ctx, "deadline"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := lastDeadline(); !got.Equal(clientDeadline) {
+		t.Errorf("handler deadline is %s, want the client deadline %s", got, clientDeadline)
+	}
+
+	// a plain NATS request with a later deadline is bound by the 2s timeout of the method
+	msg := nats.NewMsg("autonats.Store.Do")
+	msg.Data = []byte("deadline")
+	msg.Header.Set(autonats.HeaderDeadline, time.Now().Add(time.Hour).UTC().Format(time.RFC3339Nano))
+
+	sent := time.Now()
+
+	if _, err := nc.RequestMsg(msg, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := lastDeadline(); got.Before(sent.Add(2*time.Second)) || got.After(time.Now().Add(2*time.Second)) {
+		t.Errorf("handler deadline is %s after the request, want the 2s method timeout", got.Sub(sent))
+	}
+}
+
+func TestFixtureExpired(t *testing.T) {
+	srv := newStoreServer()
+	nc, _ := runStore(t, srv)
+	expired := autonats.ExpiredMessages()
+
+	msg := nats.NewMsg("autonats.Store.Do")
+	msg.Data = []byte("expired")
+	msg.Header.Set(autonats.HeaderDeadline, time.Now().Add(-time.Second).UTC().Format(time.RFC3339Nano))
+
+	if err := nc.PublishMsg(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	autonats.Eventually(t, "the message to be skipped", func() bool { return autonats.ExpiredMessages()-expired == 1 })
+
+	if n := srv.callCount("expired"); n != 0 {
+		t.Errorf("expired message was handled %d times", n)
+	}
+}
+
+func TestFixtureAsync(t *testing.T) {
+	srv := newStoreServer()
+	nc, _ := runStore(t, srv)
+	client := fixture.NewStoreClient(nc)
+
+	if err := client.Touch(context.Background(), "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	autonats.Eventually(t, "Touch to be handled", func() bool { return srv.callCount("Touch") == 1 })
+}
+
+// Implements the fixture StoreEvents, counting the events it receives
+type eventsServer struct {
+	updated int32
+	deleted int32
+}
+
+func (s *eventsServer) Updated(ctx context.Context, item *fixture.Item) {
+	atomic.AddInt32(&s.updated, 1)
+}
+
+func (s *eventsServer) Deleted(ctx context.Context, id string) error {
+	atomic.AddInt32(&s.deleted, 1)
+	return autonats.NewError(autonats.NotFound, id+" not found")
+}
+
+// Starts a StoreEvents subscriber with the options
+func runSubscriber(t *testing.T, nc *nats.Conn, srv *eventsServer, opts ...autonats.HandlerOption) {
+	t.Helper()
+
+	h := fixture.NewStoreEventsSubscriber(srv, nc, opts...)
+
+	if err := h.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = h.Shutdown(context.Background()) })
+}
+
+func TestFixtureEventsFanOut(t *testing.T) {
+	nc := autonats.RunTestServer(t, false)
+	subs := []*eventsServer{{}, {}}
+
+	for _, srv := range subs {
+		runSubscriber(t, nc, srv)
+	}
+
+	fixture.NewStoreEventsPublisher(nc).Updated(context.Background(), &fixture.Item{ID: "x"})
+
+	autonats.Eventually(t, "every subscriber to receive the event", func() bool {
+		return atomic.LoadInt32(&subs[0].updated) == 1 && atomic.LoadInt32(&subs[1].updated) == 1
+	})
+}
+
+func TestFixtureEventsQueueGroup(t *testing.T) {
+	nc := autonats.RunTestServer(t, false)
+	subs := []*eventsServer{{}, {}}
+
+	for _, srv := range subs {
+		runSubscriber(t, nc, srv, autonats.WithQueueGroup("store"))
+	}
+
+	pub := fixture.NewStoreEventsPublisher(nc)
+
+	for i := 0; i < 10; i++ {
+		pub.Updated(context.Background(), &fixture.Item{ID: "x"})
+	}
+
+	total := func() int32 { return atomic.LoadInt32(&subs[0].updated) + atomic.LoadInt32(&subs[1].updated) }
+
+	autonats.Eventually(t, "the events to be received", func() bool { return total() >= 10 })
+
+	// events received twice would show up a little later
+	time.Sleep(100 * time.Millisecond)
+
+	if n := total(); n != 10 {
+		t.Errorf("the group received %d events, want 10", n)
+	}
+}
+
+func TestFixtureEventsErrors(t *testing.T) {
+	nc := autonats.RunTestServer(t, false)
+	errs := make(chan error, 1)
+
+	runSubscriber(t, nc, &eventsServer{}, autonats.WithErrorHandler(func(ctx context.Context, info *autonats.CallInfo, err error) {
+		if info.Service == "StoreEvents" && info.Method == "Deleted" {
+			errs <- err
+		}
+	}))
+
+	if err := fixture.NewStoreEventsPublisher(nc).Deleted(context.Background(), "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errs:
+		if autonats.CodeOf(err) != autonats.NotFound || err.Error() != "x not found" {
+			t.Errorf("error handler got %v with code %s", err, autonats.CodeOf(err))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the error handler wasn't called")
+	}
+}
+
+func TestFixtureDedup(t *testing.T) {
+	srv := newStoreServer()
+	nc, _ := runStore(t, srv, autonats.WithDedupStore(autonats.NewMemoryDedupStore(time.Minute)))
+	client := fixture.NewStoreClient(nc)
+	ctx := autonats.WithIdempotencyKey(context.Background(), "key1")
+
+	for i := 0; i < 2; i++ {
+		if res, err := client.Do(ctx, "count"); err != nil || res != "count 1" {
+			t.Fatalf("call %d returned %q, %v, want the stored reply", i+1, res, err)
+		}
+	}
+
+	if res, err := client.Do(autonats.WithIdempotencyKey(ctx, "key2"), "count"); err != nil || res != "count 2" {
+		t.Fatalf("call with another key returned %q, %v", res, err)
+	}
+
+	// failed calls aren't stored
+	failCtx := autonats.WithIdempotencyKey(ctx, "key3")
+
+	for i := 0; i < 2; i++ {
+		_, _ = client.Do(failCtx, "fail")
+	}
+
+	if n := srv.callCount("fail"); n != 2 {
+		t.Errorf("failed call was handled %d times, want 2", n)
+	}
+}
+
+func TestFixtureBreaker(t *testing.T) {
+	srv := newStoreServer()
+	nc, _ := runStore(t, srv)
+
+	var mu sync.Mutex
+	var changes []string
+
+	client := fixture.NewStoreClient(nc, autonats.WithMethodCircuitBreaker("Do", autonats.BreakerConfig{
+		MinCalls:    2,
+		ErrorRate:   0.5,
+		OpenTimeout: 100 * time.Millisecond,
+		TrialCalls:  1,
+		OnStateChange: func(name string, from, to autonats.BreakerState) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			changes = append(changes, fmt.Sprintf("%s %s -> %s", name, from, to))
+		},
+	}))
+
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Do(ctx, "fail"); errors.Is(err, autonats.ErrCircuitOpen) {
+			t.Fatalf("call %d was rejected before the breaker opened", i+1)
+		}
+	}
+
+	// rejected without being sent
+	if _, err := client.Do(ctx, "ok"); !errors.Is(err, autonats.ErrCircuitOpen) || autonats.CodeOf(err) != autonats.FailedPrecondition {
+		t.Fatalf("got %v, want an error wrapping ErrCircuitOpen", err)
+	}
+
+	if n := srv.callCount("ok"); n != 0 {
+		t.Fatalf("open breaker let %d calls through", n)
+	}
+
+	// methods without a breaker aren't affected
+	if _, err := client.Get(ctx, "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if res, err := client.Do(ctx, "ok"); err != nil || res != "ok 1" {
+		t.Fatalf("trial call returned %q, %v", res, err)
+	}
+
+	want := []string{"Store.Do closed -> open", "Store.Do open -> half-open", "Store.Do half-open -> closed"}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("got state changes %v, want %v", changes, want)
+	}
+}
+
+func TestFixtureOTel(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	prev := otel.GetTracerProvider()
+
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	srv := newStoreServer()
+	nc, _ := runStore(t, srv)
+	client := fixture.NewStoreClient(nc)
+
+	parentCtx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+
+	if _, err := client.Get(parentCtx, "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = client.Do(parentCtx, "fail")
+
+	parent.End()
+
+	// server spans end once the reply is sent, which may be after the client got it
+	autonats.Eventually(t, "the spans to be exported", func() bool { return len(exporter.GetSpans()) == 5 })
+
+	spans := make(map[string]tracetest.SpanStub)
+
+	for _, s := range exporter.GetSpans() {
+		spans[s.Name+" "+s.SpanKind.String()] = s
+	}
+
+	for _, method := range []string{"Get", "Do"} {
+		client, ok := spans["Store/"+method+" client"]
+		server, ok2 := spans["Store/"+method+" server"]
+
+		if !ok || !ok2 {
+			t.Fatalf("missing client or server span of %s: %v", method, spans)
+		}
+
+		if client.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("client span of %s isn't a child of the caller span", method)
+		}
+
+		if server.Parent.SpanID() != client.SpanContext.SpanID() || !server.Parent.IsRemote() {
+			t.Errorf("server span of %s isn't a remote child of the client span", method)
+		}
+
+		if server.SpanContext.TraceID() != parent.SpanContext().TraceID() {
+			t.Errorf("server span of %s isn't part of the caller trace", method)
+		}
+
+		status, code := autonats.OK, codes.Unset
+
+		if method == "Do" {
+			status, code = autonats.Unavailable, codes.Error
+		}
+
+		for _, s := range []tracetest.SpanStub{client, server} {
+			assertAttributes(t, s, map[attribute.Key]string{
+				"rpc.system":                 "autonats",
+				"rpc.service":                "Store",
+				"rpc.method":                 method,
+				"messaging.system":           "nats",
+				"messaging.destination.name": "autonats.Store." + method,
+				"rpc.autonats.status_code":   strconv.Itoa(int(status)),
+			})
+
+			if s.Status.Code != code {
+				t.Errorf("%s %s span has status %s, want %s", s.Name, s.SpanKind, s.Status.Code, code)
+			}
+		}
+	}
+
+	if kind := spans["parent internal"].SpanKind; kind != trace.SpanKindInternal {
+		t.Errorf("parent span has kind %s", kind)
+	}
+}
+
+func assertAttributes(t *testing.T, s tracetest.SpanStub, want map[attribute.Key]string) {
+	t.Helper()
+
+	got := make(map[attribute.Key]string)
+
+	for _, kv := range s.Attributes {
+		got[kv.Key] = kv.Value.Emit()
+	}
+
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s %s span has %s=%q, want %q", s.Name, s.SpanKind, k, got[k], v)
+		}
+	}
+}
+
+// Instruments are forwarded to the first meter provider set, so it's only set once and tests
+// compare the calls recorded before and after they run
+var metricReader = sync.OnceValue(func() sdkmetric.Reader {
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	return reader
+})
+
+func TestFixtureMetrics(t *testing.T) {
+	reader := metricReader()
+	before := collectCalls(t, reader)
+
+	srv := newStoreServer()
+	nc, _ := runStore(t, srv, autonats.WithLogger(log.New(io.Discard, "", 0)))
+	client := fixture.NewStoreClient(nc)
+	ctx := context.Background()
+
+	if _, err := client.Get(ctx, "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = client.Do(ctx, "fail")
+	_, _ = client.Do(ctx, "panic")
+
+	// the panic is recorded as an Internal error on the server
+	want := map[string]map[string]int64{
+		"rpc.server.duration":        {"Get ok": 1, "Do unavailable": 1, "Do internal": 1},
+		"rpc.client.duration":        {"Get ok": 1, "Do unavailable": 1, "Do internal": 1},
+		"autonats.rpc.server.errors": {"Do unavailable": 1, "Do internal": 1},
+		"autonats.rpc.client.errors": {"Do unavailable": 1, "Do internal": 1},
+	}
+
+	var got map[string]map[string]int64
+
+	// server calls end once the reply is sent, which may be after the client got it
+	autonats.Eventually(t, "the server calls to be recorded", func() bool {
+		got = collectCalls(t, reader)
+
+		for name, calls := range got {
+			for key, n := range calls {
+				if calls[key] = n - before[name][key]; calls[key] == 0 {
+					delete(calls, key)
+				}
+			}
+		}
+
+		return reflect.DeepEqual(got["autonats.rpc.server.errors"], want["autonats.rpc.server.errors"])
+	})
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got calls by metric and method %v, want %v", got, want)
+	}
+}
+
+// Collects the number of calls recorded by each autonats metric, by method and code
+func collectCalls(t *testing.T, reader sdkmetric.Reader) map[string]map[string]int64 {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := make(map[string]map[string]int64)
+
+	add := func(name string, attrs attribute.Set, n int64) {
+		method, _ := attrs.Value("rpc.method")
+		code, _ := attrs.Value("rpc.autonats.status_code")
+
+		if calls[name] == nil {
+			calls[name] = make(map[string]int64)
+		}
+
+		calls[name][method.AsString()+" "+autonats.Code(code.AsInt64()).String()] += n
+	}
+
+	for _, sm := range rm.ScopeMetrics {
+		if sm.Scope.Name != autonats.InstrumentationName {
+			continue
+		}
+
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					add(m.Name, dp.Attributes, int64(dp.Count))
+				}
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					add(m.Name, dp.Attributes, dp.Value)
+				}
+			}
+		}
+	}
+
+	return calls
+}
@@ -0,0 +1,115 @@
+package autonats
+
+import (
+	"golang.org/x/tools/go/packages"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const fixtureDir = "testdata/fixture"
+
+func newTestParser(t *testing.T, tracing TracingMode, dirs ...string) (*Parser, Diagnostics) {
+	t.Helper()
+
+	par := NewParser(&ParserConfig{
+		DefaultTimeout:     5 * time.Second,
+		OutputFileName:     "nats_client.go",
+		DefaultConcurrency: 5,
+		Tracing:            tracing,
+	})
+
+	if err := par.ParseDir(dirs...); err != nil {
+		t.Fatal(err)
+	}
+
+	return par, par.Run()
+}
+
+// Generates the fixture in every tracing mode and type checks it along with the generated code
+func TestGenerateFixture(t *testing.T) {
+	for _, mode := range []TracingMode{TracingNone, TracingOpenTracing, TracingOTel} {
+		name := string(mode)
+
+		if mode == TracingNone {
+			name = "none"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			par, diags := newTestParser(t, mode, fixtureDir)
+
+			if len(diags) > 0 {
+				t.Fatalf("unexpected diagnostics: %v", diags)
+			}
+
+			list := par.renderData()
+
+			if len(list) != 1 {
+				t.Fatalf("got %d packages to render, want 1", len(list))
+			}
+
+			out, err := RenderSource(list[0])
+
+			if err != nil {
+				t.Fatalf("%s\n%s", err.Error(), out)
+			}
+
+			outFile, _ := filepath.Abs(list[0].OutFile())
+
+			pkgs, err := packages.Load(&packages.Config{
+				Mode:    loadMode,
+				Dir:     fixtureDir,
+				Overlay: map[string][]byte{outFile: out},
+			}, ".")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, e := range pkgs[0].Errors {
+				t.Errorf("generated code doesn't compile: %s", e.Error())
+			}
+		})
+	}
+
+	// the runtime tests use the fixture generated with OpenTelemetry
+	par, _ := newTestParser(t, TracingOTel, fixtureDir)
+	stale, err := par.Check()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stale) > 0 {
+		t.Errorf("%s is out of date, run go run ./cmd/autonats g -d ./%s --tracing=otel\n%s", stale[0].Path, fixtureDir, stale[0].Diff(stale[0].Path))
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	_, diags := newTestParser(t, TracingNone, "testdata/diagnostics")
+
+	want := []string{
+		"diagnostics.go:5:4: error: @nats:server requires a service name",
+		"diagnostics.go:11:4: warning: unknown annotation @nats:retries",
+		`diagnostics.go:13:5: error: invalid @nats:timeout value "soon": time: invalid duration "soon"`,
+		"diagnostics.go:16:2: error: Bad: method NoContext: first param must be of type context.Context",
+		"diagnostics.go:18:2: error: Bad: method NoError: last result must be of type error",
+		"diagnostics.go:22:6: error: NotInterface is not an interface",
+	}
+
+	if len(diags) != len(want) {
+		t.Fatalf("got %d diagnostics, want %d: %v", len(diags), len(want), diags)
+	}
+
+	for i, d := range diags {
+		d.Pos.Filename = filepath.Base(d.Pos.Filename)
+
+		if got := d.String(); got != want[i] {
+			t.Errorf("diagnostic %d is %q, want %q", i, got, want[i])
+		}
+	}
+
+	if !diags.HasErrors() {
+		t.Error("diagnostics have no errors")
+	}
+}
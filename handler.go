@@ -2,51 +2,281 @@ package autonats
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Handler interface {
-	Run(ctx context.Context) error // Subscribes to the queue and dispatches handler go-routines
-	Shutdown()                     // Shuts down all handlers gracefully
+	Run(ctx context.Context) error      // Subscribes to the queue and dispatches handler go-routines
+	Shutdown(ctx context.Context) error // Drains all handlers gracefully, waiting for in-flight calls until ctx is done
 }
 
 type Runner struct {
-	sub *nats.Subscription
+	sub      subscription
+	subject  string
+	opts     *HandlerOptions
+	handleFn func(msg *nats.Msg) error
+	msgs     chan delivery
+	done     chan struct{} // Closed once the subscription stops delivering messages
+	doneOnce sync.Once
+	workers  sync.WaitGroup
+	inFlight int64
 }
 
+// Source of the messages of a runner, implemented by *nats.Subscription
+type subscription interface {
+	Drain() error
+	Unsubscribe() error
+	IsValid() bool
+	Pending() (int, int, error)
+}
+
+// Message received by a runner, durable messages are acked once they're handled
+type delivery struct {
+	msg *nats.Msg
+	ack func(err error)
+}
+
+// Interval at which Drain checks whether the subscription delivered all its pending messages
+const drainPollInterval = 10 * time.Millisecond
+
+var recoveredPanics, expiredMessages uint64
+
+// Number of panics recovered by runners since the process started
+func RecoveredPanics() uint64 {
+	return atomic.LoadUint64(&recoveredPanics)
+}
+
+// Number of messages skipped by runners since the process started, because their deadline
+// expired before a worker was available
+func ExpiredMessages() uint64 {
+	return atomic.LoadUint64(&expiredMessages)
+}
+
+// Returned by Drain when its context is done before all messages are handled
+type DrainError struct {
+	Subject  string
+	InFlight int // Messages that were still being handled
+	Pending  int // Messages that were received but not handled
+}
+
+func (e *DrainError) Error() string {
+	return fmt.Sprintf("autonats: drain of %s cut off with %d in-flight and %d pending messages", e.Subject, e.InFlight, e.Pending)
+}
+
+// Unsubscribes right away, messages that aren't being handled yet are dropped
 func (r *Runner) Shutdown() error {
-	return r.sub.Unsubscribe()
+	err := r.sub.Unsubscribe()
+	r.stop()
+
+	return err
+}
+
+// Stops accepting new messages, then waits for the pending and in-flight messages to be handled
+// until ctx is done. If ctx is done first, pending messages are dropped and a DrainError reports
+// the messages that were cut off.
+func (r *Runner) Drain(ctx context.Context) error {
+	if err := r.sub.Drain(); err != nil && err != nats.ErrBadSubscription {
+		return err
+	}
+
+	for r.sub.IsValid() {
+		select {
+		case <-ctx.Done():
+			return r.cutOff()
+		case <-time.After(drainPollInterval):
+		}
+	}
+
+	r.stop()
+
+	stopped := make(chan struct{})
+
+	go func() {
+		r.workers.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return r.cutOff()
+	}
+}
+
+// Stops handling messages once a drain runs out of time and reports the messages left
+func (r *Runner) cutOff() error {
+	e := &DrainError{Subject: r.subject, InFlight: int(atomic.LoadInt64(&r.inFlight))}
+
+	if pending, _, err := r.sub.Pending(); err == nil {
+		e.Pending = pending
+	}
+
+	_ = r.sub.Unsubscribe()
+	r.stop()
+
+	return e
+}
+
+func (r *Runner) stop() {
+	r.doneOnce.Do(func() {
+		close(r.done)
+	})
+}
+
+// Drains runners concurrently, see Runner.Drain
+func DrainRunners(ctx context.Context, runners ...*Runner) error {
+	errs := make([]error, len(runners))
+
+	var wg sync.WaitGroup
+
+	for i, r := range runners {
+		if r == nil {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(i int, r *Runner) {
+			defer wg.Done()
+			errs[i] = r.Drain(ctx)
+		}(i, r)
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
 }
 
 func StartRunner(ctx context.Context, nc *nats.Conn, subj, group string, concurrency int, handleFn func(msg *nats.Msg)) (*Runner, error) {
-	subChan := make(chan *nats.Msg)
+	return NewHandlerOptions().StartRunner(ctx, nc, subj, group, concurrency, handleFn)
+}
+
+// Starts a runner handling messages with the options. Panics in handleFn are recovered: they're
+// logged with their stack and a correlation ID, which is sent to the caller in an Internal error.
+func (o *HandlerOptions) StartRunner(ctx context.Context, nc *nats.Conn, subj, group string, concurrency int, handleFn func(msg *nats.Msg)) (*Runner, error) {
+	r := o.newRunner(subj, func(msg *nats.Msg) error {
+		handleFn(msg)
+		return nil
+	})
 
-	sub, err := nc.ChanQueueSubscribe(subj, group, subChan)
+	// messages wait in the subscription until a worker is available
+	sub, err := nc.QueueSubscribe(subj, group, func(msg *nats.Msg) {
+		r.deliver(ctx, delivery{msg: msg})
+	})
 
 	if err != nil {
 		return nil, err
 	}
 
+	r.sub = sub
+	r.start(ctx, concurrency)
+
+	return r, nil
+}
+
+func (o *HandlerOptions) newRunner(subj string, handleFn func(msg *nats.Msg) error) *Runner {
+	return &Runner{
+		subject:  subj,
+		opts:     o,
+		handleFn: handleFn,
+		msgs:     make(chan delivery),
+		done:     make(chan struct{}),
+	}
+}
+
+// Hands a message over to a worker, blocking until one is available or the runner stops
+func (r *Runner) deliver(ctx context.Context, d delivery) {
+	select {
+	case r.msgs <- d:
+	case <-r.done:
+	case <-ctx.Done():
+	}
+}
+
+// Starts the workers handling the delivered messages
+func (r *Runner) start(ctx context.Context, concurrency int) {
 	for i := 0; i < concurrency; i++ {
+		r.workers.Add(1)
+
 		go func() {
-			var msg *nats.Msg
-			var ok bool
+			defer r.workers.Done()
 
 			for {
 				select {
 				case <-ctx.Done():
 					return
 
-				case msg, ok = <-subChan:
-					if !ok {
-						return
-					}
+				case <-r.done:
+					return
 
-					handleFn(msg)
+				case d := <-r.msgs:
+					r.handle(d)
 				}
 			}
 		}()
 	}
+}
+
+func (r *Runner) handle(d delivery) {
+	// the caller gave up while the message was queued, durable messages have no caller
+	if d.ack == nil && Expired(d.msg) {
+		atomic.AddUint64(&expiredMessages, 1)
+		return
+	}
 
-	return &Runner{sub: sub}, nil
+	atomic.AddInt64(&r.inFlight, 1)
+	defer atomic.AddInt64(&r.inFlight, -1)
+
+	err := r.run(d.msg)
+
+	if d.ack != nil {
+		d.ack(err)
+	}
+}
+
+func (r *Runner) run(msg *nats.Msg) (err error) {
+	defer r.recoverPanic(msg, &err)
+	return r.handleFn(msg)
+}
+
+// Recovers a panic in handleFn, which fails the message with an Internal error
+func (r *Runner) recoverPanic(msg *nats.Msg, err *error) {
+	v := recover()
+
+	if v == nil {
+		return
+	}
+
+	atomic.AddUint64(&recoveredPanics, 1)
+
+	id := nuid.Next()
+
+	r.opts.logger().Printf("recovered panic handling %s, correlation ID %s: %v\n%s", msg.Subject, id, v, debug.Stack())
+
+	e := Errorf(Internal, "autonats: internal error, correlation ID %s", id).
+		WithDetails(map[string]interface{}{"correlation_id": id})
+	*err = e
+
+	if msg.Reply != "" {
+		reply := GetReply()
+		defer PutReply(reply)
+
+		reply.SetError(e)
+
+		if data, err := reply.MarshalBinary(); err == nil {
+			_ = msg.Respond(data)
+		}
+	}
+
+	if r.opts.Repanic {
+		panic(v)
+	}
 }
@@ -0,0 +1,79 @@
+package autonats
+
+import (
+	"fmt"
+	"go/types"
+)
+
+// Package names used by the generated code, which imported packages can't shadow
+var reservedImportNames = map[string]string{
+	"autonats":    "github.com/zyra/autonats",
+	"nats":        "github.com/nats-io/nats.go",
+	"context":     "context",
+	"time":        "time",
+	"opentracing": "github.com/opentracing/opentracing-go",
+	"ext":         "github.com/opentracing/opentracing-go/ext",
+	"log":         "github.com/opentracing/opentracing-go/log",
+}
+
+type Import struct {
+	Name string // Import alias, empty when the package name can be used as is
+	Path string
+}
+
+// Assigns a unique name to every package referenced by the generated code
+type importSet struct {
+	names map[string]string // path -> name
+	paths map[string]string // name -> path
+}
+
+func newImportSet() *importSet {
+	s := &importSet{
+		names: make(map[string]string),
+		paths: make(map[string]string),
+	}
+
+	for name, path := range reservedImportNames {
+		s.paths[name] = path
+	}
+
+	return s
+}
+
+// Returns the name used to refer to the package, adding it to the set if needed
+func (s *importSet) add(pkg *types.Package) string {
+	if name, ok := s.names[pkg.Path()]; ok {
+		return name
+	}
+
+	name := pkg.Name()
+
+	for i := 1; s.paths[name] != "" && s.paths[name] != pkg.Path(); i++ {
+		name = fmt.Sprintf("%s%d", pkg.Name(), i)
+	}
+
+	s.names[pkg.Path()] = name
+	s.paths[name] = pkg.Path()
+
+	return name
+}
+
+// Returns a qualifier that renders types relative to the given package, recording every
+// other package it's called with in imports (path -> alias, empty when not aliased)
+func (s *importSet) qualifier(target *types.Package, imports map[string]string) types.Qualifier {
+	return func(pkg *types.Package) string {
+		if pkg == nil || pkg.Path() == target.Path() {
+			return ""
+		}
+
+		name := s.add(pkg)
+
+		if name == pkg.Name() {
+			imports[pkg.Path()] = ""
+		} else {
+			imports[pkg.Path()] = name
+		}
+
+		return name
+	}
+}
@@ -0,0 +1,108 @@
+package autonats
+
+import (
+	"context"
+	"github.com/nats-io/nuid"
+)
+
+// Describes the call being intercepted
+type CallInfo struct {
+	Service string // Service name, e.g. User
+	Method  string // Method name, e.g. GetById
+	Subject string // NATS subject the call is sent to
+}
+
+// Calls the service implementation. req is the decoded request: the single arg of the method,
+// a pointer to the request envelope for methods with multiple args, or nil for methods without
+// any. The result is the single value returned by the method, a pointer to the response envelope
+// for methods with multiple values, or nil for methods without any.
+type UnaryHandler func(ctx context.Context, req interface{}) (interface{}, error)
+
+// Intercepts calls on handlers, it must call handler to carry on with the call. Metadata sent
+// by the client can be read with MetadataFromContext.
+type UnaryServerInterceptor func(ctx context.Context, req interface{}, info *CallInfo, handler UnaryHandler) (interface{}, error)
+
+// Sends a call, req and the result are the same as for UnaryHandler
+type UnaryInvoker func(ctx context.Context, req interface{}) (interface{}, error)
+
+// Intercepts calls made by clients, it must call invoker to carry on with the call. Metadata can
+// be added to the context passed to invoker with WithMetadata.
+type UnaryClientInterceptor func(ctx context.Context, req interface{}, info *CallInfo, invoker UnaryInvoker) (interface{}, error)
+
+// Calls handler through the interceptors
+func (o *HandlerOptions) Intercept(ctx context.Context, req interface{}, info *CallInfo, handler UnaryHandler) (interface{}, error) {
+	if o == nil || o.chain == nil {
+		return handler(ctx, req)
+	}
+
+	return o.chain(ctx, req, info, handler)
+}
+
+func chainServerInterceptors(interceptors []UnaryServerInterceptor) UnaryServerInterceptor {
+	switch len(interceptors) {
+	case 0:
+		return nil
+	case 1:
+		return interceptors[0]
+	}
+
+	return func(ctx context.Context, req interface{}, info *CallInfo, handler UnaryHandler) (interface{}, error) {
+		return interceptors[0](ctx, req, info, serverChainHandler(interceptors, 1, info, handler))
+	}
+}
+
+// Returns a handler calling the interceptor at index i, or the final handler
+func serverChainHandler(interceptors []UnaryServerInterceptor, i int, info *CallInfo, handler UnaryHandler) UnaryHandler {
+	if i == len(interceptors) {
+		return handler
+	}
+
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		return interceptors[i](ctx, req, info, serverChainHandler(interceptors, i+1, info, handler))
+	}
+}
+
+// Calls invoker through the interceptors, retrying it with the retry policy of the method.
+// Every attempt of the call is sent with the same idempotency key, and goes through the circuit
+// breaker of the method.
+func (o *ClientOptions) Invoke(ctx context.Context, req interface{}, info *CallInfo, invoker UnaryInvoker) (interface{}, error) {
+	if key, _ := ctx.Value(idempotencyKey{}).(string); key == "" {
+		ctx = WithIdempotencyKey(ctx, nuid.Next())
+	}
+
+	if o == nil {
+		return invoker(ctx, req)
+	}
+
+	invoker = o.retryPolicy(info.Method).invoker(o.breaker(info).invoker(invoker))
+
+	if o.chain == nil {
+		return invoker(ctx, req)
+	}
+
+	return o.chain(ctx, req, info, invoker)
+}
+
+func chainClientInterceptors(interceptors []UnaryClientInterceptor) UnaryClientInterceptor {
+	switch len(interceptors) {
+	case 0:
+		return nil
+	case 1:
+		return interceptors[0]
+	}
+
+	return func(ctx context.Context, req interface{}, info *CallInfo, invoker UnaryInvoker) (interface{}, error) {
+		return interceptors[0](ctx, req, info, clientChainInvoker(interceptors, 1, info, invoker))
+	}
+}
+
+// Returns an invoker calling the interceptor at index i, or the final invoker
+func clientChainInvoker(interceptors []UnaryClientInterceptor, i int, info *CallInfo, invoker UnaryInvoker) UnaryInvoker {
+	if i == len(interceptors) {
+		return invoker
+	}
+
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		return interceptors[i](ctx, req, info, clientChainInvoker(interceptors, i+1, info, invoker))
+	}
+}
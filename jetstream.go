@@ -0,0 +1,296 @@
+package autonats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"strconv"
+	"time"
+)
+
+// Headers set on dead-lettered messages, in addition to the headers of the original message
+const (
+	HeaderError      = "Autonats-Error"      // Message of the error that failed the last delivery
+	HeaderErrorCode  = "Autonats-Error-Code" // Code of the error that failed the last delivery
+	HeaderDeliveries = "Autonats-Deliveries" // Number of times the message was delivered
+)
+
+// Deliveries of a durable message before it's dead-lettered, unless the method sets @nats:max-deliver
+const DefaultMaxDeliver = 5
+
+// Time the server waits for a durable message to be acked on top of the method timeout,
+// before delivering it again, unless the config sets AckWaitGrace
+const ackWaitGrace = 5 * time.Second
+
+// Configures the stream and consumer of a durable method
+type DurableConfig struct {
+	Service           string
+	Method            string
+	Timeout           time.Duration   // Method timeout, unacked messages are redelivered once it elapses
+	MaxDeliver        int             // Deliveries before a failing message is dead-lettered
+	Backoff           []time.Duration // Delays before redelivering failed messages, the last one is repeated
+	DeadLetterSubject string          // Subject exhausted messages are published to
+	AckWaitGrace      time.Duration   // Time unacked messages get on top of the timeout before they're redelivered
+}
+
+// Name of the JetStream stream holding the calls of a service's durable methods
+func DurableStreamName(service string) string {
+	return "AUTONATS_" + service
+}
+
+// Subject durable calls of a method are published to
+func DurableSubject(service, method string) string {
+	return fmt.Sprintf("autonats.durable.%s.%s", service, method)
+}
+
+// Default subject exhausted calls of a durable method are published to
+func DeadLetterSubject(service, method string) string {
+	return fmt.Sprintf("autonats.dead.%s.%s", service, method)
+}
+
+// Returns the delay before a message that failed on the given delivery is delivered again
+func (c *DurableConfig) backoff(delivered int) time.Duration {
+	if len(c.Backoff) == 0 {
+		return 0
+	}
+
+	if delivered > len(c.Backoff) {
+		delivered = len(c.Backoff)
+	}
+
+	return c.Backoff[delivered-1]
+}
+
+// Whether a failed durable call is worth retrying, calls failing with codes that mean the
+// request itself is wrong are dead-lettered right away. Calls to other services rejected by an
+// open circuit breaker are retried, since the breaker closes on its own.
+func Retryable(err error) bool {
+	if errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+
+	switch CodeOf(err) {
+	case InvalidArgument, NotFound, AlreadyExists, PermissionDenied, FailedPrecondition,
+		OutOfRange, Unimplemented, Unauthenticated:
+		return false
+	}
+
+	return true
+}
+
+// Creates the stream of a service's durable methods if it doesn't exist yet. Existing streams
+// are left as they are, so they can be created upfront with custom settings.
+func ensureDurableStream(ctx context.Context, js jetstream.JetStream, service string) error {
+	name := DurableStreamName(service)
+	_, err := js.Stream(ctx, name)
+
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		_, err = js.CreateStream(ctx, jetstream.StreamConfig{
+			Name:      name,
+			Subjects:  []string{DurableSubject(service, ">")},
+			Retention: jetstream.WorkQueuePolicy,
+			Storage:   jetstream.FileStorage,
+		})
+
+		// another client or handler created it in the meantime
+		if errors.Is(err, jetstream.ErrStreamNameAlreadyInUse) {
+			err = nil
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("autonats: failed to create stream %s: %s", name, err.Error())
+	}
+
+	return nil
+}
+
+// Publishes a durable call with default client options, see ClientOptions.PublishDurable
+func PublishDurable(ctx context.Context, nc *nats.Conn, service string, msg *nats.Msg) error {
+	return NewClientOptions().PublishDurable(ctx, nc, service, msg)
+}
+
+// Publishes a durable call into the stream of its service and waits for the server to store it.
+// Retried calls are stored once as long as they're published within the duplicate window of the
+// stream, 2 minutes by default.
+func (o *ClientOptions) PublishDurable(ctx context.Context, nc *nats.Conn, service string, msg *nats.Msg) error {
+	js, err := jetstream.New(nc)
+
+	if err != nil {
+		return err
+	}
+
+	if key := msg.Header.Get(HeaderIdempotencyKey); key != "" {
+		msg.Header.Set(jetstream.MsgIDHeader, msg.Subject+":"+key)
+	}
+
+	name := DurableStreamName(service)
+
+	if _, ok := o.streams.Load(name); !ok {
+		if err = ensureDurableStream(ctx, js, service); err != nil {
+			return err
+		}
+
+		o.streams.Store(name, true)
+	}
+
+	if _, err = js.PublishMsg(ctx, msg); errors.Is(err, jetstream.ErrNoStreamResponse) {
+		// the stream was deleted, it's created again by the next call
+		o.streams.Delete(name)
+	}
+
+	return err
+}
+
+// Adapts a JetStream consume context to the subscription of a runner
+type consumeSubscription struct {
+	cc jetstream.ConsumeContext
+}
+
+func (s consumeSubscription) Drain() error {
+	s.cc.Drain()
+	return nil
+}
+
+func (s consumeSubscription) Unsubscribe() error {
+	s.cc.Stop()
+	return nil
+}
+
+func (s consumeSubscription) IsValid() bool {
+	select {
+	case <-s.cc.Closed():
+		return false
+	default:
+		return true
+	}
+}
+
+// Messages that aren't acked stay in the stream, so none are pending in the client
+func (s consumeSubscription) Pending() (int, int, error) {
+	return 0, 0, nil
+}
+
+// Starts a runner consuming the calls of a durable method through a durable pull consumer.
+// Messages are acked once handleFn succeeds. Failed messages are delivered again after the
+// configured backoff, until they fail with an error that isn't Retryable or run out of
+// deliveries, in which case they're published to the dead-letter subject and terminated.
+// Messages that weren't acked in time, e.g. because the handler crashed, are dead-lettered
+// when they're delivered once more than MaxDeliver allows.
+func (o *HandlerOptions) StartDurableRunner(ctx context.Context, nc *nats.Conn, cfg DurableConfig, concurrency int, handleFn func(msg *nats.Msg) error) (*Runner, error) {
+	if cfg.MaxDeliver <= 0 {
+		cfg.MaxDeliver = DefaultMaxDeliver
+	}
+
+	if cfg.DeadLetterSubject == "" {
+		cfg.DeadLetterSubject = DeadLetterSubject(cfg.Service, cfg.Method)
+	}
+
+	if cfg.AckWaitGrace <= 0 {
+		cfg.AckWaitGrace = ackWaitGrace
+	}
+
+	js, err := jetstream.New(nc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = ensureDurableStream(ctx, js, cfg.Service); err != nil {
+		return nil, err
+	}
+
+	subj := DurableSubject(cfg.Service, cfg.Method)
+
+	consumer, err := js.CreateOrUpdateConsumer(ctx, DurableStreamName(cfg.Service), jetstream.ConsumerConfig{
+		Durable:       cfg.Service + "_" + cfg.Method,
+		FilterSubject: subj,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       cfg.Timeout + cfg.AckWaitGrace,
+		// the server stops delivering exhausted messages without telling the runner, so it
+		// keeps delivering them and the runner dead-letters them instead
+		MaxDeliver: -1,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("autonats: failed to create consumer for %s: %s", subj, err.Error())
+	}
+
+	r := o.newRunner(subj, handleFn)
+
+	// only pull as many messages as there are workers, so buffered messages don't run out of ack time
+	cc, err := consumer.Consume(func(m jetstream.Msg) {
+		msg := &nats.Msg{Subject: m.Subject(), Header: m.Headers(), Data: m.Data()}
+
+		if delivered := numDelivered(m); delivered > cfg.MaxDeliver {
+			err := Errorf(DeadlineExceeded, "autonats: %s wasn't acked after %d deliveries", msg.Subject, delivered-1)
+			r.deadLetter(ctx, nc, &cfg, m, msg, err, delivered-1)
+			return
+		}
+
+		r.deliver(ctx, delivery{msg: msg, ack: func(err error) {
+			r.settle(ctx, nc, &cfg, m, msg, err)
+		}})
+	}, jetstream.PullMaxMessages(concurrency))
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.sub = consumeSubscription{cc: cc}
+	r.start(ctx, concurrency)
+
+	return r, nil
+}
+
+// Returns the number of times a durable message was delivered, including the current delivery
+func numDelivered(m jetstream.Msg) int {
+	meta, err := m.Metadata()
+
+	if err != nil {
+		return 1
+	}
+
+	return int(meta.NumDelivered)
+}
+
+// Acks, redelivers or dead-letters a durable message depending on the result of its handler
+func (r *Runner) settle(ctx context.Context, nc *nats.Conn, cfg *DurableConfig, m jetstream.Msg, msg *nats.Msg, err error) {
+	if err == nil {
+		_ = m.Ack()
+		return
+	}
+
+	delivered := numDelivered(m)
+
+	if Retryable(err) && delivered < cfg.MaxDeliver {
+		_ = m.NakWithDelay(cfg.backoff(delivered))
+		return
+	}
+
+	r.deadLetter(ctx, nc, cfg, m, msg, err, delivered)
+}
+
+// Publishes a durable message to the dead-letter subject and terminates it
+func (r *Runner) deadLetter(ctx context.Context, nc *nats.Conn, cfg *DurableConfig, m jetstream.Msg, msg *nats.Msg, err error, delivered int) {
+	dead := nats.NewMsg(cfg.DeadLetterSubject)
+	dead.Data = msg.Data
+
+	for k, v := range msg.Header {
+		dead.Header[k] = v
+	}
+
+	dead.Header.Set(HeaderError, err.Error())
+	dead.Header.Set(HeaderErrorCode, CodeOf(err).String())
+	dead.Header.Set(HeaderDeliveries, strconv.Itoa(delivered))
+
+	if pubErr := nc.PublishMsg(dead); pubErr != nil {
+		r.opts.logger().Printf("failed to dead-letter %s: %s", msg.Subject, pubErr.Error())
+	}
+
+	_ = m.TermWithReason(err.Error())
+
+	r.opts.HandleError(ctx, &CallInfo{Service: cfg.Service, Method: cfg.Method, Subject: msg.Subject}, err)
+}
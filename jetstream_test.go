@@ -0,0 +1,314 @@
+package autonats
+
+import (
+	"context"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Starts an embedded NATS server, with JetStream if jetStream is set, and connects to it
+func runTestServer(t *testing.T, jetStream bool) *nats.Conn {
+	t.Helper()
+
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		NoLog:     true,
+		NoSigs:    true,
+		JetStream: jetStream,
+		StoreDir:  t.TempDir(),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Start()
+
+	if !s.ReadyForConnections(10 * time.Second) {
+		t.Fatal("nats server didn't start")
+	}
+
+	t.Cleanup(s.Shutdown)
+
+	nc, err := nats.Connect(s.ClientURL())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(nc.Close)
+
+	return nc
+}
+
+// Waits for cond to hold, failing the test after a few seconds
+func eventually(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", msg)
+		}
+	}
+}
+
+// Records the deliveries of a durable test method
+type durableRecorder struct {
+	mu     sync.Mutex
+	times  []time.Time
+	errs   []error
+	result func(delivery int) error
+}
+
+func (d *durableRecorder) handle(msg *nats.Msg) error {
+	d.mu.Lock()
+	d.times = append(d.times, time.Now())
+	n := len(d.times)
+	d.mu.Unlock()
+
+	return d.result(n)
+}
+
+func (d *durableRecorder) deliveries() []time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]time.Time(nil), d.times...)
+}
+
+func (d *durableRecorder) handleError(ctx context.Context, info *CallInfo, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.errs = append(d.errs, err)
+}
+
+type durableTest struct {
+	t    *testing.T
+	nc   *nats.Conn
+	cfg  DurableConfig
+	rec  *durableRecorder
+	dead *nats.Subscription
+}
+
+func newDurableTest(t *testing.T, cfg DurableConfig, concurrency int, result func(delivery int) error) *durableTest {
+	nc := runTestServer(t, true)
+	cfg.Service, cfg.Method = "Jobs", "Run"
+
+	if cfg.Timeout == 0 {
+		cfg.Timeout = time.Second
+	}
+
+	dt := &durableTest{t: t, nc: nc, cfg: cfg, rec: &durableRecorder{result: result}}
+
+	var err error
+
+	if dt.dead, err = nc.SubscribeSync(DeadLetterSubject(cfg.Service, cfg.Method)); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := NewHandlerOptions(WithErrorHandler(dt.rec.handleError))
+	r, err := opts.StartDurableRunner(context.Background(), nc, cfg, concurrency, dt.rec.handle)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = r.Shutdown() })
+
+	return dt
+}
+
+func (dt *durableTest) publish(data string) {
+	msg := NewRequestMsg(context.Background(), dt.nc, DurableSubject(dt.cfg.Service, dt.cfg.Method), "")
+	msg.Data = []byte(data)
+
+	if err := PublishDurable(context.Background(), dt.nc, dt.cfg.Service, msg); err != nil {
+		dt.t.Fatal(err)
+	}
+}
+
+// Waits for the stream to be empty, which happens once every message is acked or terminated
+func (dt *durableTest) waitSettled() {
+	dt.t.Helper()
+
+	js, _ := jetstream.New(dt.nc)
+	stream, err := js.Stream(context.Background(), DurableStreamName(dt.cfg.Service))
+
+	if err != nil {
+		dt.t.Fatal(err)
+	}
+
+	eventually(dt.t, "the stream to be empty", func() bool {
+		info, err := stream.Info(context.Background())
+		return err == nil && info.State.Msgs == 0
+	})
+}
+
+func (dt *durableTest) nextDead() *nats.Msg {
+	dt.t.Helper()
+
+	msg, err := dt.dead.NextMsg(5 * time.Second)
+
+	if err != nil {
+		dt.t.Fatalf("no dead letter: %s", err.Error())
+	}
+
+	return msg
+}
+
+func (dt *durableTest) assertDead(msg *nats.Msg, code Code, deliveries string) {
+	dt.t.Helper()
+
+	if string(msg.Data) != "job" {
+		dt.t.Errorf("dead letter payload is %q, want %q", msg.Data, "job")
+	}
+
+	if got := msg.Header.Get(HeaderErrorCode); got != code.String() {
+		dt.t.Errorf("dead letter code is %s, want %s", got, code)
+	}
+
+	if got := msg.Header.Get(HeaderDeliveries); got != deliveries {
+		dt.t.Errorf("dead letter deliveries are %s, want %s", got, deliveries)
+	}
+
+	if msg.Header.Get(HeaderError) == "" {
+		dt.t.Error("dead letter has no error")
+	}
+}
+
+func TestDurableAck(t *testing.T) {
+	dt := newDurableTest(t, DurableConfig{}, 2, func(int) error { return nil })
+	dt.publish("job")
+	dt.waitSettled()
+
+	if n := len(dt.rec.deliveries()); n != 1 {
+		t.Errorf("handled %d times, want 1", n)
+	}
+
+	js, _ := jetstream.New(dt.nc)
+	consumer, err := js.Consumer(context.Background(), DurableStreamName("Jobs"), "Jobs_Run")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the runner counts deliveries itself, see StartDurableRunner
+	if max := consumer.CachedInfo().Config.MaxDeliver; max != -1 {
+		t.Errorf("consumer max deliver is %d, want -1", max)
+	}
+
+	if wait := consumer.CachedInfo().Config.AckWait; wait != dt.cfg.Timeout+ackWaitGrace {
+		t.Errorf("consumer ack wait is %s, want the timeout plus %s", wait, ackWaitGrace)
+	}
+}
+
+func TestDurableNakBackoff(t *testing.T) {
+	backoff := []time.Duration{100 * time.Millisecond, 300 * time.Millisecond}
+
+	dt := newDurableTest(t, DurableConfig{Backoff: backoff}, 2, func(delivery int) error {
+		if delivery < 3 {
+			return NewError(Unavailable, "down")
+		}
+
+		return nil
+	})
+
+	dt.publish("job")
+	dt.waitSettled()
+
+	times := dt.rec.deliveries()
+
+	if len(times) != 3 {
+		t.Fatalf("handled %d times, want 3", len(times))
+	}
+
+	for i, d := range backoff {
+		if gap := times[i+1].Sub(times[i]); gap < d {
+			t.Errorf("delivery %d came %s after the previous one, want at least %s", i+2, gap, d)
+		}
+	}
+
+	if len(dt.rec.errs) != 0 {
+		t.Errorf("retried failures were passed to the error handler: %v", dt.rec.errs)
+	}
+}
+
+func TestDurableTermNotRetryable(t *testing.T) {
+	dt := newDurableTest(t, DurableConfig{MaxDeliver: 5}, 2, func(int) error {
+		return NewError(NotFound, "missing")
+	})
+
+	dt.publish("job")
+	dt.assertDead(dt.nextDead(), NotFound, "1")
+	dt.waitSettled()
+
+	// terminated messages aren't delivered again
+	time.Sleep(100 * time.Millisecond)
+
+	if n := len(dt.rec.deliveries()); n != 1 {
+		t.Errorf("handled %d times, want 1", n)
+	}
+
+	eventually(t, "the error handler", func() bool {
+		dt.rec.mu.Lock()
+		defer dt.rec.mu.Unlock()
+
+		return len(dt.rec.errs) == 1 && CodeOf(dt.rec.errs[0]) == NotFound
+	})
+}
+
+func TestDurableDeadLetterExhausted(t *testing.T) {
+	dt := newDurableTest(t, DurableConfig{MaxDeliver: 3}, 2, func(int) error {
+		return NewError(Unavailable, "down")
+	})
+
+	dt.publish("job")
+	dt.assertDead(dt.nextDead(), Unavailable, "3")
+	dt.waitSettled()
+
+	if n := len(dt.rec.deliveries()); n != 3 {
+		t.Errorf("handled %d times, want 3", n)
+	}
+}
+
+func TestDurableDeadLetterAckWait(t *testing.T) {
+	// handlers hang until the test ends, so deliveries run out through the ack wait
+	release := make(chan struct{})
+
+	dt := newDurableTest(t, DurableConfig{Timeout: 200 * time.Millisecond, MaxDeliver: 2, AckWaitGrace: time.Millisecond}, 4, func(int) error {
+		<-release
+		return nil
+	})
+
+	t.Cleanup(func() { close(release) })
+
+	dt.publish("job")
+	dt.assertDead(dt.nextDead(), DeadlineExceeded, "2")
+	dt.waitSettled()
+
+	if n := len(dt.rec.deliveries()); n != 2 {
+		t.Errorf("handled %d times, want 2", n)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{NewError(Unavailable, "down"), true},
+		{NewError(NotFound, "missing"), false},
+		{NewError(FailedPrecondition, "not ready"), false},
+		{&Error{Code: FailedPrecondition, cause: ErrCircuitOpen}, true},
+	} {
+		if got := Retryable(tt.err); got != tt.want {
+			t.Errorf("Retryable(%v) = %t, want %t", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package autonats
+
+import (
+	"context"
+	"github.com/nats-io/nats.go"
+	"strings"
+	"time"
+)
+
+// Headers set on requests by generated clients, which require NATS server 2.2 or newer
+const (
+	HeaderDeadline = "Autonats-Deadline" // Absolute deadline of the call in RFC 3339 format
+	HeaderCaller   = "Autonats-Caller"   // Name of the client connection, see nats.Name
+	HeaderCodec    = "Autonats-Codec"    // Codec used to encode the payload
+
+	HeaderIdempotencyKey = "Autonats-Idempotency-Key" // Key shared by all attempts of a call
+
+	MetadataHeaderPrefix = "Autonats-Md-" // Prefix of the headers carrying user metadata
+)
+
+// Arbitrary key/value pairs sent along with calls
+type Metadata map[string]string
+
+// Returns the value of key, or an empty string
+func (md Metadata) Get(key string) string {
+	return md[key]
+}
+
+type metadataKey struct{}
+
+type callerKey struct{}
+
+type idempotencyKey struct{}
+
+type incomingIdempotencyKey struct{}
+
+// Returns a context whose calls are sent with the given idempotency key instead of a generated
+// one, e.g. to deduplicate calls made for the same business operation. Keys are scoped to the
+// called method, so the context shouldn't be used for several calls to the same method.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// Returns the idempotency key of the call being handled, which is the same for every attempt
+func IdempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(incomingIdempotencyKey{}).(string)
+	return key
+}
+
+// Returns a context carrying md in addition to the metadata already in ctx. Clients send the
+// metadata of the call context, and handlers receive it in the context passed to the server, so
+// it's propagated to calls made by handlers as well.
+func WithMetadata(ctx context.Context, md Metadata) context.Context {
+	parent, _ := ctx.Value(metadataKey{}).(Metadata)
+	merged := make(Metadata, len(parent)+len(md))
+
+	for k, v := range parent {
+		merged[k] = v
+	}
+
+	for k, v := range md {
+		merged[k] = v
+	}
+
+	return context.WithValue(ctx, metadataKey{}, merged)
+}
+
+// Returns a copy of the metadata carried by ctx, nil if there is none
+func MetadataFromContext(ctx context.Context) Metadata {
+	md, ok := ctx.Value(metadataKey{}).(Metadata)
+
+	if !ok {
+		return nil
+	}
+
+	cp := make(Metadata, len(md))
+
+	for k, v := range md {
+		cp[k] = v
+	}
+
+	return cp
+}
+
+// Returns the connection name of the client that sent the call being handled, if it has one
+func CallerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerKey{}).(string)
+	return caller
+}
+
+// Creates a request message with the deadline, metadata and idempotency key of ctx, the client
+// connection name and the payload codec, if any, in its headers
+func NewRequestMsg(ctx context.Context, nc *nats.Conn, subject, codec string) *nats.Msg {
+	msg := nats.NewMsg(subject)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		msg.Header.Set(HeaderDeadline, deadline.UTC().Format(time.RFC3339Nano))
+	}
+
+	if nc != nil && nc.Opts.Name != "" {
+		msg.Header.Set(HeaderCaller, nc.Opts.Name)
+	}
+
+	if codec != "" {
+		msg.Header.Set(HeaderCodec, codec)
+	}
+
+	if key, ok := ctx.Value(idempotencyKey{}).(string); ok && key != "" {
+		msg.Header.Set(HeaderIdempotencyKey, key)
+	}
+
+	if md, ok := ctx.Value(metadataKey{}).(Metadata); ok {
+		for k, v := range md {
+			msg.Header.Set(MetadataHeaderPrefix+k, v)
+		}
+	}
+
+	return msg
+}
+
+// Returns a context carrying the metadata, caller and idempotency key sent in the headers of a
+// request. The idempotency key isn't sent along with calls made with the context.
+func ContextFromMsg(ctx context.Context, msg *nats.Msg) context.Context {
+	if len(msg.Header) == 0 {
+		return ctx
+	}
+
+	var md Metadata
+
+	for k, v := range msg.Header {
+		if len(v) > 0 && strings.HasPrefix(k, MetadataHeaderPrefix) {
+			if md == nil {
+				md = make(Metadata)
+			}
+
+			md[strings.TrimPrefix(k, MetadataHeaderPrefix)] = v[0]
+		}
+	}
+
+	if md != nil {
+		ctx = WithMetadata(ctx, md)
+	}
+
+	if caller := msg.Header.Get(HeaderCaller); caller != "" {
+		ctx = context.WithValue(ctx, callerKey{}, caller)
+	}
+
+	if key := msg.Header.Get(HeaderIdempotencyKey); key != "" {
+		ctx = context.WithValue(ctx, incomingIdempotencyKey{}, key)
+	}
+
+	return ctx
+}
+
+// Returns the deadline sent in the headers of a request
+func DeadlineFromMsg(msg *nats.Msg) (time.Time, bool) {
+	value := msg.Header.Get(HeaderDeadline)
+
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	deadline, err := time.Parse(time.RFC3339Nano, value)
+
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return deadline, true
+}
+
+// Returns a context for handling a request, which is done once the timeout elapses or the
+// deadline sent by the client expires, whichever comes first
+func ContextWithDeadline(ctx context.Context, msg *nats.Msg, timeout time.Duration) (context.Context, context.CancelFunc) {
+	deadline := time.Now().Add(timeout)
+
+	if d, ok := DeadlineFromMsg(msg); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	return context.WithDeadline(ctx, deadline)
+}
+
+// Whether the deadline sent with a request already expired, in which case the client stopped
+// waiting for the reply
+func Expired(msg *nats.Msg) bool {
+	deadline, ok := DeadlineFromMsg(msg)
+	return ok && !time.Now().Before(deadline)
+}
+
+// Decodes the payload of a request with the named codec. Requests whose codec header names
+// another codec return a CodecMismatchError without being decoded.
+func DecodeMsg(codecName string, msg *nats.Msg, v interface{}) error {
+	if codec := msg.Header.Get(HeaderCodec); codec != "" && codec != codecName {
+		return &CodecMismatchError{Got: codec, Want: codecName}
+	}
+
+	return Decode(codecName, msg.Data, v)
+}
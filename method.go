@@ -1,53 +1,297 @@
 package autonats
 
 import (
+	"fmt"
 	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+	"time"
 )
 
+// Identifiers used by the generated client and handler code that params can't shadow
+var reservedParamNames = map[string]bool{
+	"client": true, "h": true, "msg": true, "t": true, "err": true, "data": true, "req": true,
+	"reply": true, "replyMsg": true, "replySpan": true, "reqSpan": true, "reqCtx": true,
+	"result": true, "cancelFn": true, "innerCtx": true, "innerCtxT": true, "tracer": true, "sc": true,
+	"call": true, "reqMsg": true, "payload": true, "resp": true, "info": true,
+}
+
 // Describes a service method that's exposed to the service mesh
 type Method struct {
 	Name               string
 	Params             []*Param
 	Results            []*Param
-	imports            map[string]bool
-	HandlerConcurrency int // Method handler concurrency
-	Timeout            int // Method timeout
+	HandlerConcurrency int             // Method handler concurrency
+	Timeout            time.Duration   // Method timeout
+	Async              bool            // Fire-and-forget method, published without waiting for a reply
+	Durable            bool            // Fire-and-forget method delivered at least once through JetStream
+	MaxDeliver         int             // Deliveries of a durable call before it's dead-lettered
+	Backoff            []time.Duration // Delays before durable calls are delivered again
+	DeadLetterSubject  string          // Subject exhausted durable calls are published to
+	Retry              *RetryPolicy    // Default retry policy of clients, nil if calls aren't retried
+	pos                token.Pos
 }
 
-func MethodFromField(field *ast.Field) *Method {
-	fx := field.Type.(*ast.FuncType)
+// Params sent over the wire, which are all params except the leading context
+func (m *Method) Args() []*Param {
+	if len(m.Params) < 2 {
+		return nil
+	}
 
-	nParams := fx.Params.NumFields()
-	nResults := fx.Results.NumFields()
+	return m.Params[1:]
+}
+
+// Whether the method args need to be wrapped in a request envelope
+func (m *Method) RequestEnvelope() bool {
+	return len(m.Args()) > 1
+}
+
+// Whether the args are JSON encoded, a single string arg is sent as is
+func (m *Method) EncodesArgs() bool {
+	args := m.Args()
+	return len(args) > 1 || (len(args) == 1 && !args[0].IsString())
+}
+
+// Results returned to the caller, which are all results except the trailing error
+func (m *Method) Values() []*Param {
+	if len(m.Results) < 2 {
+		return nil
+	}
+
+	return m.Results[:len(m.Results)-1]
+}
+
+// Whether the method returns an error, which fire-and-forget methods may not
+func (m *Method) ReturnsError() bool {
+	return len(m.Results) > 0
+}
+
+// Whether the method returns any values besides the error
+func (m *Method) HasResult() bool {
+	return len(m.Values()) > 0
+}
+
+// Whether the method results need to be wrapped in a response envelope
+func (m *Method) ResponseEnvelope() bool {
+	return len(m.Values()) > 1
+}
+
+// Creates a method from a type checked interface method. Invalid annotations are reported to r.
+func MethodFromFunc(fn *types.Func, q types.Qualifier, r *Reporter, docs ...*ast.CommentGroup) (*Method, error) {
+	sig := fn.Type().(*types.Signature)
 
 	m := &Method{
-		Params:             make([]*Param, nParams, nParams),
-		Results:            make([]*Param, nResults, nResults),
-		imports:            make(map[string]bool),
-		Name:               field.Names[0].Name,
-		HandlerConcurrency: 0, // TODO: add custom tag/comment to define concurrency for each method
-		Timeout:            0, // TODO: add custom  tag/comment to define timeout for each method
+		Params:  make([]*Param, sig.Params().Len()),
+		Results: make([]*Param, sig.Results().Len()),
+		Name:    fn.Name(),
+		pos:     fn.Pos(),
+	}
+
+	args := parseAnnotations(docs...)
+	args.checkKnown(r, "timeout", "concurrency", "async", "durable", "max-deliver", "backoff", "dead-letter",
+		"retry", "retry-backoff", "retry-codes")
+
+	m.Timeout = args.duration(r, "timeout")
+	m.HandlerConcurrency = args.concurrency(r, "concurrency")
+
+	if len(m.Params) == 0 || !isContext(sig.Params().At(0).Type()) {
+		return nil, fmt.Errorf("method %s: first param must be of type context.Context", m.Name)
+	}
+
+	// params are in scope of the generated client methods, so they can't shadow the packages
+	// of the method's types
+	qualifiers := make(map[string]bool)
+	q = recordQualifiers(q, qualifiers)
+
+	for i := range m.Params {
+		par, err := ParamFromVar(sig.Params().At(i), sig.Variadic() && i == len(m.Params)-1, q)
+
+		if err != nil {
+			return nil, fmt.Errorf("method %s: %s", m.Name, err.Error())
+		}
+
+		m.Params[i] = par
+	}
+
+	for i := range m.Results {
+		result, err := ParamFromVar(sig.Results().At(i), false, q)
+
+		if err != nil {
+			return nil, fmt.Errorf("method %s: %s", m.Name, err.Error())
+		}
+
+		m.Results[i] = result
+	}
+
+	m.normalizeParamNames(qualifiers)
+
+	// methods without results are always fire-and-forget, methods returning an error only
+	// can opt in with @nats:async
+	async := args.flag(r, "async")
+	m.Durable = args.flag(r, "durable")
+
+	if n := len(m.Results); n == 0 {
+		m.Async = true
+	} else if !m.Results[n-1].IsError() {
+		return nil, fmt.Errorf("method %s: last result must be of type error", m.Name)
+	} else if async || m.Durable {
+		if m.HasResult() {
+			key := "async"
+
+			if m.Durable {
+				key = "durable"
+			}
+
+			return nil, fmt.Errorf("method %s: %s%s methods can't return values", m.Name, DocPrefix, key)
+		}
+
+		m.Async = true
+	}
+
+	m.parseDurable(args, r)
+	m.parseRetry(args, r)
+
+	used := make(map[string]bool)
+
+	for i, r := range m.Values() {
+		if r.Name == "" || r.Name == "_" || used[r.Name] {
+			r.Name = fmt.Sprintf("result%d", i+1)
+		}
+
+		used[r.Name] = true
 	}
 
-	for ii, p := range fx.Params.List {
-		par := ParseParam(p)
-		m.Params[ii] = par
+	setFieldNames(m.Args())
+	setFieldNames(m.Values())
 
-		for k := range par.RequiredImports {
-			m.imports[k] = true
+	return m, nil
+}
+
+// Reads the delivery settings of a durable method, which are ignored by other methods
+func (m *Method) parseDurable(args annotations, r *Reporter) {
+	if !m.Durable {
+		for _, key := range []string{"max-deliver", "backoff", "dead-letter"} {
+			if a, ok := args[key]; ok {
+				r.Warnf(a.Pos, "%s%s is ignored without %sdurable", DocPrefix, key, DocPrefix)
+			}
 		}
+
+		return
+	}
+
+	m.MaxDeliver = args.concurrency(r, "max-deliver")
+
+	if m.MaxDeliver == 0 {
+		m.MaxDeliver = DefaultMaxDeliver
 	}
 
-	if fx.Results != nil && len(fx.Results.List) > 0 {
-		for ii, r := range fx.Results.List {
-			result := ParseParam(r)
-			m.Results[ii] = result
+	if a, ok := args["backoff"]; ok {
+		for _, value := range strings.Split(a.Value, ",") {
+			d, err := ParseDuration(value)
 
-			for k := range result.RequiredImports {
-				m.imports[k] = true
+			if err != nil {
+				r.Errorf(a.Pos, "invalid %sbackoff value %q: %s", DocPrefix, a.Value, err.Error())
+				break
 			}
+
+			m.Backoff = append(m.Backoff, d)
+		}
+	}
+
+	if a, ok := args["dead-letter"]; ok {
+		if a.Value == "" || strings.ContainsAny(a.Value, "*>") {
+			r.Errorf(a.Pos, "invalid %sdead-letter value %q: must be a subject without wildcards", DocPrefix, a.Value)
 		}
+
+		m.DeadLetterSubject = a.Value
 	}
+}
 
-	return m
+// Reads the retry policy of a method, @nats:retry sets the attempts and the other keys
+// are ignored without it
+func (m *Method) parseRetry(args annotations, r *Reporter) {
+	if _, ok := args["retry"]; !ok {
+		for _, key := range []string{"retry-backoff", "retry-codes"} {
+			if a, ok := args[key]; ok {
+				r.Warnf(a.Pos, "%s%s is ignored without %sretry", DocPrefix, key, DocPrefix)
+			}
+		}
+
+		return
+	}
+
+	m.Retry = &RetryPolicy{MaxAttempts: args.concurrency(r, "retry")}
+
+	if a, ok := args["retry-backoff"]; ok {
+		values := strings.Split(a.Value, ",")
+
+		for i, value := range values {
+			d, err := ParseDuration(value)
+
+			if err != nil || len(values) > 2 {
+				r.Errorf(a.Pos, "invalid %sretry-backoff value %q: must be an initial delay and an optional max delay", DocPrefix, a.Value)
+				break
+			}
+
+			if i == 0 {
+				m.Retry.InitialBackoff = d
+			} else {
+				m.Retry.MaxBackoff = d
+			}
+		}
+	}
+
+	if a, ok := args["retry-codes"]; ok {
+		for _, value := range strings.Split(a.Value, ",") {
+			code, err := ParseCode(value)
+
+			if err != nil {
+				r.Errorf(a.Pos, "invalid %sretry-codes value %q: %s", DocPrefix, a.Value, err.Error())
+				break
+			}
+
+			m.Retry.RetryableCodes = append(m.Retry.RetryableCodes, code)
+		}
+	}
+}
+
+func isContext(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "context" && named.Obj().Name() == "Context"
+}
+
+// Returns a qualifier recording the package names q returns in names
+func recordQualifiers(q types.Qualifier, names map[string]bool) types.Qualifier {
+	return func(pkg *types.Package) string {
+		name := q(pkg)
+
+		if name != "" {
+			names[name] = true
+		}
+
+		return name
+	}
+}
+
+// Makes sure every param has a unique name that doesn't clash with the generated code or the
+// packages of the method's types. The leading context is always named ctx.
+func (m *Method) normalizeParamNames(qualifiers map[string]bool) {
+	used := make(map[string]bool)
+
+	for i, p := range m.Params {
+		if i == 0 {
+			p.Name = "ctx"
+		} else if p.Name == "" || p.Name == "_" {
+			p.Name = fmt.Sprintf("arg%d", i)
+		}
+
+		name := p.Name
+
+		for n := 1; used[p.Name] || (i > 0 && (reservedParamNames[p.Name] || reservedImportNames[p.Name] != "" || qualifiers[p.Name] || p.Name == "ctx")); n++ {
+			p.Name = fmt.Sprintf("%s%d", name, n)
+		}
+
+		used[p.Name] = true
+	}
 }
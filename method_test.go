@@ -0,0 +1,138 @@
+package autonats
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+type testImporter struct {
+	pkgs   map[string]*types.Package
+	source types.Importer
+}
+
+func (i *testImporter) Import(path string) (*types.Package, error) {
+	if pkg, ok := i.pkgs[path]; ok {
+		return pkg, nil
+	}
+
+	return i.source.Import(path)
+}
+
+// Type checks files given as path -> source, in dependency order, and returns the last package
+func checkSources(t *testing.T, files ...[2]string) (*types.Package, *token.FileSet) {
+	t.Helper()
+
+	fset := token.NewFileSet()
+	imp := &testImporter{pkgs: make(map[string]*types.Package), source: importer.ForCompiler(fset, "source", nil)}
+
+	var pkg *types.Package
+
+	for _, f := range files {
+		file, err := parser.ParseFile(fset, f[0]+"/file.go", f[1], parser.ParseComments)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conf := &types.Config{Importer: imp}
+
+		if pkg, err = conf.Check(f[0], fset, []*ast.File{file}, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		imp.pkgs[f[0]] = pkg
+	}
+
+	return pkg, fset
+}
+
+func TestMethodParamNames(t *testing.T) {
+	pkg, fset := checkSources(t,
+		[2]string{"example.com/sub", "package sub\n\ntype Tag struct{}\n"},
+		[2]string{"example.com/api", `package api
+
+import (
+	"context"
+	"example.com/sub"
+)
+
+type Service interface {
+	Get(ctx context.Context, sub *sub.Tag) (*sub.Tag, error)
+	Put(c context.Context, reply string, sub1 []sub.Tag, _ int, msg, arg4 string) error
+	List(ctx context.Context, not, jsoniter string, time int) error
+}
+`})
+
+	iface := pkg.Scope().Lookup("Service").Type().Underlying().(*types.Interface)
+	imports := newImportSet()
+	q := imports.qualifier(pkg, make(map[string]string))
+
+	tests := map[string][]string{
+		"Get": {"ctx", "sub1"},
+		"Put": {"ctx", "reply1", "sub1", "arg3", "msg1", "arg4"},
+		// only names of packages the generated code imports are reserved
+		"List": {"ctx", "not", "jsoniter", "time1"},
+	}
+
+	for i := 0; i < iface.NumMethods(); i++ {
+		fn := iface.Method(i)
+		m, err := MethodFromFunc(fn, q, &Reporter{Fset: fset})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := tests[fn.Name()]
+
+		if len(m.Params) != len(want) {
+			t.Fatalf("%s has %d params, want %d", fn.Name(), len(m.Params), len(want))
+		}
+
+		for j, p := range m.Params {
+			if p.Name != want[j] {
+				t.Errorf("%s param %d is named %s, want %s", fn.Name(), j, p.Name, want[j])
+			}
+		}
+	}
+}
+
+func TestMethodFieldNames(t *testing.T) {
+	pkg, fset := checkSources(t, [2]string{"example.com/api", `package api
+
+import "context"
+
+type Service interface {
+	Put(ctx context.Context, id string, Id int, _key string, 名 string) (_n int, N int, result1 string, err error)
+}
+`})
+
+	fn := pkg.Scope().Lookup("Service").Type().Underlying().(*types.Interface).Method(0)
+	m, err := MethodFromFunc(fn, newImportSet().qualifier(pkg, make(map[string]string)), &Reporter{Fset: fset})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		params []*Param
+		want   []string
+	}{
+		{m.Args(), []string{"Id", "Id1", "Key", "X名"}},
+		{m.Values(), []string{"N", "N1", "Result1"}},
+	} {
+		var got []string
+
+		for _, p := range tt.params {
+			got = append(got, p.FieldName())
+		}
+
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("got field names %v, want %v", got, tt.want)
+		}
+	}
+}
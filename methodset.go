@@ -0,0 +1,216 @@
+package autonats
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"golang.org/x/tools/go/packages"
+	"sort"
+)
+
+// Flattens a service interface and the interfaces it embeds into a list of methods,
+// keeping the declaration order and the doc comments of every method
+type methodSet struct {
+	pkg     *packages.Package
+	q       types.Qualifier
+	r       *Reporter
+	files   map[string]*ast.File // parsed files by name, used to find the docs of embedded interfaces
+	methods []*Method
+	funcs   map[string]*types.Func // method name -> declaration
+	origins map[string]string      // method name -> interface that declared it
+}
+
+func newMethodSet(pkg *packages.Package, q types.Qualifier, r *Reporter) *methodSet {
+	ms := &methodSet{
+		pkg:     pkg,
+		q:       q,
+		r:       r,
+		files:   make(map[string]*ast.File),
+		methods: make([]*Method, 0),
+		funcs:   make(map[string]*types.Func),
+		origins: make(map[string]string),
+	}
+
+	for i, f := range pkg.Syntax {
+		ms.files[pkg.CompiledGoFiles[i]] = f
+	}
+
+	return ms
+}
+
+// Adds the methods of an interface. node is the interface declaration, when available, and is
+// used to keep the declaration order and to read method annotations.
+func (ms *methodSet) addInterface(iface *types.Interface, node *ast.InterfaceType, origin string) {
+	if node == nil {
+		ms.addInterfaceTypes(iface, origin)
+		return
+	}
+
+	embedded := 0
+
+	for _, field := range node.Methods.List {
+		if len(field.Names) == 0 {
+			if embedded >= iface.NumEmbeddeds() {
+				ms.r.Errorf(field.Pos(), "%s: missing type information for embedded %s", origin, types.ExprString(field.Type))
+				continue
+			}
+
+			ms.addEmbedded(iface.EmbeddedType(embedded), field.Pos(), origin)
+
+			embedded++
+			continue
+		}
+
+		for _, name := range field.Names {
+			fn := explicitMethod(iface, name.Name)
+
+			if fn == nil {
+				ms.r.Errorf(name.Pos(), "%s: missing type information for method %s", origin, name.Name)
+				continue
+			}
+
+			ms.addMethod(fn, origin, field.Doc, field.Comment)
+		}
+	}
+}
+
+// Adds the methods of an interface without a declaration. Explicit methods come first, sorted
+// by position, followed by the embedded interfaces.
+func (ms *methodSet) addInterfaceTypes(iface *types.Interface, origin string) {
+	funcs := make([]*types.Func, iface.NumExplicitMethods())
+
+	for i := range funcs {
+		funcs[i] = iface.ExplicitMethod(i)
+	}
+
+	sort.Slice(funcs, func(i, j int) bool {
+		return funcs[i].Pos() < funcs[j].Pos()
+	})
+
+	for _, fn := range funcs {
+		ms.addMethod(fn, origin)
+	}
+
+	for i := 0; i < iface.NumEmbeddeds(); i++ {
+		ms.addEmbedded(iface.EmbeddedType(i), token.NoPos, origin)
+	}
+}
+
+// Adds the methods of an embedded interface, pos is where it's embedded
+func (ms *methodSet) addEmbedded(t types.Type, pos token.Pos, origin string) {
+	t = types.Unalias(t)
+	typeName := types.TypeString(t, ms.nameQualifier)
+
+	iface, ok := t.Underlying().(*types.Interface)
+
+	if !ok || !iface.IsMethodSet() {
+		ms.r.Errorf(pos, "%s: embedded type %s is not an interface", origin, typeName)
+		return
+	}
+
+	named, ok := t.(*types.Named)
+
+	if !ok {
+		ms.addInterface(iface, nil, origin)
+		return
+	}
+
+	if named.Obj().Pkg() == nil {
+		ms.r.Errorf(pos, "%s: embedding predeclared type %s is not supported", origin, typeName)
+		return
+	}
+
+	ms.addInterface(iface, ms.findInterfaceDecl(named.Obj()), typeName)
+}
+
+func (ms *methodSet) addMethod(fn *types.Func, origin string, docs ...*ast.CommentGroup) {
+	if prev, ok := ms.funcs[fn.Name()]; ok {
+		if prev == fn {
+			// same interface embedded more than once
+			return
+		}
+
+		if !types.Identical(prev.Type(), fn.Type()) {
+			ms.r.Errorf(fn.Pos(), "duplicate method %s: declared in %s and %s with different signatures", fn.Name(), ms.origins[fn.Name()], origin)
+			return
+		}
+
+		ms.r.Warnf(fn.Pos(), "duplicate method %s: declared in %s and %s, using the declaration from %s", fn.Name(), ms.origins[fn.Name()], origin, ms.origins[fn.Name()])
+
+		return
+	}
+
+	m, err := MethodFromFunc(fn, ms.q, ms.r, docs...)
+
+	if err != nil {
+		ms.r.Errorf(fn.Pos(), "%s: %s", origin, err.Error())
+		return
+	}
+
+	ms.funcs[fn.Name()] = fn
+	ms.origins[fn.Name()] = origin
+	ms.methods = append(ms.methods, m)
+}
+
+// Finds the interface declaration of a named type, parsing its source file if it belongs to another package
+func (ms *methodSet) findInterfaceDecl(obj *types.TypeName) *ast.InterfaceType {
+	fileName := ms.pkg.Fset.Position(obj.Pos()).Filename
+
+	if fileName == "" {
+		return nil
+	}
+
+	file, ok := ms.files[fileName]
+
+	if !ok {
+		var err error
+
+		// parsed into the package file set so that annotation positions can be reported
+		if file, err = parser.ParseFile(ms.pkg.Fset, fileName, nil, parser.ParseComments); err != nil {
+			file = nil
+		}
+
+		ms.files[fileName] = file
+	}
+
+	if file == nil {
+		return nil
+	}
+
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gen.Specs {
+			if ts, ok := spec.(*ast.TypeSpec); ok && ts.Name.Name == obj.Name() {
+				iface, _ := ts.Type.(*ast.InterfaceType)
+				return iface
+			}
+		}
+	}
+
+	return nil
+}
+
+// Qualifies types with their package name, used to describe where a method was declared
+func (ms *methodSet) nameQualifier(pkg *types.Package) string {
+	if pkg.Path() == ms.pkg.PkgPath {
+		return ""
+	}
+
+	return pkg.Name()
+}
+
+func explicitMethod(iface *types.Interface, name string) *types.Func {
+	for i := 0; i < iface.NumExplicitMethods(); i++ {
+		if fn := iface.ExplicitMethod(i); fn.Name() == name {
+			return fn
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package autonats
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+)
+
+// Logs errors that can't be returned to a caller, e.g. panics recovered by handlers.
+// *log.Logger implements it.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+var defaultLogger Logger = log.New(os.Stderr, "autonats: ", log.LstdFlags)
+
+// Receives the errors of fire-and-forget calls, which have no caller to return them to
+type ErrorHandler func(ctx context.Context, info *CallInfo, err error)
+
+// Options of generated handlers
+type HandlerOptions struct {
+	Interceptors []UnaryServerInterceptor
+	Logger       Logger       // Defaults to a logger writing to stderr
+	Repanic      bool         // Whether to panic again after a recovered panic is logged and replied to
+	OnError      ErrorHandler // Receives errors returned by fire-and-forget methods and dead-lettered durable calls, logged by default
+	QueueGroup   string       // Queue group of event subscribers, every subscriber receives each event by default
+	Dedup        DedupStore   // Replies to retried calls that were already handled, calls aren't deduplicated by default
+
+	chain UnaryServerInterceptor
+}
+
+// Configures generated handlers, see New<Service>Handler
+type HandlerOption func(opts *HandlerOptions)
+
+// Adds interceptors to a handler, the first one is the outermost
+func WithServerInterceptors(interceptors ...UnaryServerInterceptor) HandlerOption {
+	return func(opts *HandlerOptions) {
+		opts.Interceptors = append(opts.Interceptors, interceptors...)
+	}
+}
+
+// Sets the logger of a handler
+func WithLogger(logger Logger) HandlerOption {
+	return func(opts *HandlerOptions) {
+		opts.Logger = logger
+	}
+}
+
+// Makes a handler panic again after recovering from a panic in a service implementation,
+// once the panic is logged and the caller got an error, for crash-only deployments
+func WithRepanic() HandlerOption {
+	return func(opts *HandlerOptions) {
+		opts.Repanic = true
+	}
+}
+
+// Sets the callback receiving the errors returned by fire-and-forget methods and dead-lettered
+// durable calls
+func WithErrorHandler(fn ErrorHandler) HandlerOption {
+	return func(opts *HandlerOptions) {
+		opts.OnError = fn
+	}
+}
+
+// Makes an event subscriber join a queue group, so each event is handled by a single subscriber
+// of the group
+func WithQueueGroup(group string) HandlerOption {
+	return func(opts *HandlerOptions) {
+		opts.QueueGroup = group
+	}
+}
+
+// Sets the store used to deduplicate retried calls, see DedupStore
+func WithDedupStore(store DedupStore) HandlerOption {
+	return func(opts *HandlerOptions) {
+		opts.Dedup = store
+	}
+}
+
+func NewHandlerOptions(opts ...HandlerOption) *HandlerOptions {
+	o := &HandlerOptions{Logger: defaultLogger}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	o.chain = chainServerInterceptors(o.Interceptors)
+
+	return o
+}
+
+func (o *HandlerOptions) logger() Logger {
+	if o == nil || o.Logger == nil {
+		return defaultLogger
+	}
+
+	return o.Logger
+}
+
+// Passes the error of a fire-and-forget call or a dead-lettered durable call to the error handler
+func (o *HandlerOptions) HandleError(ctx context.Context, info *CallInfo, err error) {
+	if o != nil && o.OnError != nil {
+		o.OnError(ctx, info, err)
+		return
+	}
+
+	o.logger().Printf("%s.%s failed: %s", info.Service, info.Method, err.Error())
+}
+
+// Options of generated clients
+type ClientOptions struct {
+	Interceptors   []UnaryClientInterceptor
+	OnError        ErrorHandler              // Receives errors publishing methods without results, logged by default
+	Retry          *RetryPolicy              // Retry policy of methods without their own policy, calls aren't retried by default
+	MethodRetry    map[string]*RetryPolicy   // Retry policies by method name
+	AnnotatedRetry map[string]*RetryPolicy   // Retry policies of the @nats:retry annotations by method name, used when Retry is nil
+	Breaker        *BreakerConfig            // Circuit breaker of methods without their own, calls aren't broken by default
+	MethodBreaker  map[string]*BreakerConfig // Circuit breakers by method name
+
+	chain    UnaryClientInterceptor
+	breakers sync.Map // Circuit breakers by name, created on the first call
+	streams  sync.Map // Names of the durable streams known to exist, looked up on the first call
+}
+
+// Configures generated clients, see New<Service>Client
+type ClientOption func(opts *ClientOptions)
+
+// Adds interceptors to a client, the first one is the outermost
+func WithClientInterceptors(interceptors ...UnaryClientInterceptor) ClientOption {
+	return func(opts *ClientOptions) {
+		opts.Interceptors = append(opts.Interceptors, interceptors...)
+	}
+}
+
+// Sets the callback receiving the errors publishing methods without results
+func WithClientErrorHandler(fn ErrorHandler) ClientOption {
+	return func(opts *ClientOptions) {
+		opts.OnError = fn
+	}
+}
+
+// Sets the retry policy of the methods that aren't given their own with WithMethodRetryPolicy,
+// which takes precedence over the @nats:retry annotations
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(opts *ClientOptions) {
+		opts.Retry = &policy
+	}
+}
+
+// Sets the retry policy of a method, which takes precedence over the policy set with
+// WithRetryPolicy and the @nats:retry annotations
+func WithMethodRetryPolicy(method string, policy RetryPolicy) ClientOption {
+	return func(opts *ClientOptions) {
+		if opts.MethodRetry == nil {
+			opts.MethodRetry = make(map[string]*RetryPolicy)
+		}
+
+		opts.MethodRetry[method] = &policy
+	}
+}
+
+// Sets the retry policy a method is given by its @nats:retry annotations, used by generated
+// clients. The policies set with WithRetryPolicy and WithMethodRetryPolicy take precedence.
+func WithAnnotatedRetryPolicy(method string, policy RetryPolicy) ClientOption {
+	return func(opts *ClientOptions) {
+		if opts.AnnotatedRetry == nil {
+			opts.AnnotatedRetry = make(map[string]*RetryPolicy)
+		}
+
+		opts.AnnotatedRetry[method] = &policy
+	}
+}
+
+// Adds circuit breakers to the methods that don't have their own, one per method unless the
+// config is Shared
+func WithCircuitBreaker(cfg BreakerConfig) ClientOption {
+	return func(opts *ClientOptions) {
+		opts.Breaker = &cfg
+	}
+}
+
+// Adds a circuit breaker to a method, which takes precedence over the breakers added with
+// WithCircuitBreaker
+func WithMethodCircuitBreaker(method string, cfg BreakerConfig) ClientOption {
+	return func(opts *ClientOptions) {
+		if opts.MethodBreaker == nil {
+			opts.MethodBreaker = make(map[string]*BreakerConfig)
+		}
+
+		opts.MethodBreaker[method] = &cfg
+	}
+}
+
+func NewClientOptions(opts ...ClientOption) *ClientOptions {
+	o := &ClientOptions{}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	o.chain = chainClientInterceptors(o.Interceptors)
+
+	return o
+}
+
+// Passes the error of a call to a method without results to the error handler
+func (o *ClientOptions) HandleError(ctx context.Context, info *CallInfo, err error) {
+	if o != nil && o.OnError != nil {
+		o.OnError(ctx, info, err)
+		return
+	}
+
+	defaultLogger.Printf("%s.%s failed: %s", info.Service, info.Method, err.Error())
+}
@@ -0,0 +1,152 @@
+package autonats
+
+import (
+	"context"
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+	"time"
+)
+
+// Instrumentation scope of the spans and metrics created by generated code in otel tracing mode
+const InstrumentationName = "github.com/zyra/autonats"
+
+// Trace context is always propagated in NATS headers using the W3C format
+var tracePropagator = propagation.TraceContext{}
+
+var rpcSystem = semconv.RPCSystemKey.String("autonats")
+
+var messagingSystem = semconv.MessagingSystemKey.String("nats")
+
+// Code of the call set on spans and metrics, named after rpc.grpc.status_code and numbered the same way
+var statusCodeKey = attribute.Key("rpc.autonats.status_code")
+
+type otelInstruments struct {
+	duration metric.Float64Histogram
+	errors   metric.Int64Counter
+}
+
+var (
+	serverInstruments, clientInstruments otelInstruments
+	instrumentsOnce                      sync.Once
+)
+
+// Creates the instruments through the global meter provider, which forwards them to the
+// provider set with otel.SetMeterProvider even if it's set later on
+func initInstruments() {
+	meter := otel.Meter(InstrumentationName)
+
+	serverInstruments.duration, _ = meter.Float64Histogram(semconv.RPCServerDurationName,
+		metric.WithUnit(semconv.RPCServerDurationUnit),
+		metric.WithDescription(semconv.RPCServerDurationDescription))
+	serverInstruments.errors, _ = meter.Int64Counter("autonats.rpc.server.errors",
+		metric.WithUnit("{call}"),
+		metric.WithDescription("Number of handled calls that returned an error"))
+
+	clientInstruments.duration, _ = meter.Float64Histogram(semconv.RPCClientDurationName,
+		metric.WithUnit(semconv.RPCClientDurationUnit),
+		metric.WithDescription(semconv.RPCClientDurationDescription))
+	clientInstruments.errors, _ = meter.Int64Counter("autonats.rpc.client.errors",
+		metric.WithUnit("{call}"),
+		metric.WithDescription("Number of outgoing calls that failed"))
+}
+
+// Span and measurements of a call, ended with End once the call completes
+type Call struct {
+	span        trace.Span
+	start       time.Time
+	attrs       []attribute.KeyValue
+	instruments *otelInstruments
+}
+
+// Starts a server span for a received message, continuing the trace propagated in its headers
+func StartServerCall(ctx context.Context, msg *nats.Msg, service, method string) (context.Context, *Call) {
+	return startReceivedCall(ctx, trace.SpanKindServer, msg, service, method)
+}
+
+// Starts a client span for a request and injects the trace context into the message headers
+func StartClientCall(ctx context.Context, msg *nats.Msg, service, method string) (context.Context, *Call) {
+	return startSentCall(ctx, trace.SpanKindClient, msg, service, method)
+}
+
+// Starts a consumer span for a received event, continuing the trace propagated in its headers
+func StartConsumerCall(ctx context.Context, msg *nats.Msg, service, method string) (context.Context, *Call) {
+	return startReceivedCall(ctx, trace.SpanKindConsumer, msg, service, method)
+}
+
+// Starts a producer span for an event and injects the trace context into the message headers
+func StartProducerCall(ctx context.Context, msg *nats.Msg, service, method string) (context.Context, *Call) {
+	return startSentCall(ctx, trace.SpanKindProducer, msg, service, method)
+}
+
+func startReceivedCall(ctx context.Context, kind trace.SpanKind, msg *nats.Msg, service, method string) (context.Context, *Call) {
+	instrumentsOnce.Do(initInstruments)
+
+	if msg.Header != nil {
+		ctx = tracePropagator.Extract(ctx, propagation.HeaderCarrier(msg.Header))
+	}
+
+	return startCall(ctx, kind, &serverInstruments, msg.Subject, service, method)
+}
+
+func startSentCall(ctx context.Context, kind trace.SpanKind, msg *nats.Msg, service, method string) (context.Context, *Call) {
+	instrumentsOnce.Do(initInstruments)
+
+	ctx, call := startCall(ctx, kind, &clientInstruments, msg.Subject, service, method)
+
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+
+	tracePropagator.Inject(ctx, propagation.HeaderCarrier(msg.Header))
+
+	return ctx, call
+}
+
+func startCall(ctx context.Context, kind trace.SpanKind, instruments *otelInstruments, subject, service, method string) (context.Context, *Call) {
+	call := &Call{
+		start:       time.Now(),
+		instruments: instruments,
+		attrs: []attribute.KeyValue{
+			rpcSystem,
+			semconv.RPCService(service),
+			semconv.RPCMethod(method),
+		},
+	}
+
+	spanAttrs := append([]attribute.KeyValue{messagingSystem, semconv.MessagingDestinationName(subject)}, call.attrs...)
+
+	ctx, call.span = otel.Tracer(InstrumentationName).Start(ctx, service+"/"+method,
+		trace.WithSpanKind(kind),
+		trace.WithAttributes(spanAttrs...))
+
+	return ctx, call
+}
+
+// Ends the span and records the call duration, err is the result of the call
+func (c *Call) End(err error) {
+	status := statusCodeKey.Int(int(CodeOf(err)))
+
+	if err != nil {
+		c.span.RecordError(err)
+		c.span.SetStatus(codes.Error, err.Error())
+	}
+
+	c.span.SetAttributes(status)
+	c.span.End()
+
+	attrs := metric.WithAttributes(append(c.attrs, status)...)
+	ctx := context.Background()
+
+	c.instruments.duration.Record(ctx, float64(time.Since(c.start))/float64(time.Millisecond), attrs)
+
+	if err != nil {
+		c.instruments.errors.Add(ctx, 1, attrs)
+	}
+}
@@ -1,22 +1,21 @@
 package autonats
 
+// Services declared in a Go package, which are rendered into one output file in the package directory
 type Package struct {
-	Services       []*Service
-	Imports        map[string]string
-	Name           string
-	BaseDir        string
-	OriginFileName string
-	FileName       string
+	Services []*Service
+	Imports  map[string]string // Imports used by the services, path -> alias
+	Name     string            // Package name
+	Path     string            // Package import path
+	BaseDir  string            // Package directory
 }
 
 func PackageFromService(svc *Service) *Package {
 	return &Package{
-		Services:       make([]*Service, 0),
-		Imports:        make(map[string]string),
-		Name:           svc.PackageName,
-		BaseDir:        svc.Basedir,
-		OriginFileName: svc.FileName,
-		FileName:       svc.FileName,
+		Services: make([]*Service, 0),
+		Imports:  make(map[string]string),
+		Name:     svc.PackageName,
+		Path:     svc.PackagePath,
+		BaseDir:  svc.Basedir,
 	}
 }
 
@@ -27,3 +26,14 @@ func (pkg *Package) AddService(service *Service) {
 		pkg.Imports[ik] = iv
 	}
 }
+
+// Imports used by the services as a list
+func (pkg *Package) ImportList() []*Import {
+	imports := make([]*Import, 0, len(pkg.Imports))
+
+	for path, name := range pkg.Imports {
+		imports = append(imports, &Import{Name: name, Path: path})
+	}
+
+	return imports
+}
@@ -1,98 +1,78 @@
 package autonats
 
 import (
-	"go/ast"
+	"fmt"
+	"go/types"
 	"strings"
+	"unicode"
 )
 
 type Param struct {
-	Name, Type, TypePackage string
-	Pointer, Array          bool
-	RequiredImports         map[string]bool
+	Name   string
+	Type   *Type
+	goType types.Type
+	field  string // Exported field name, see setFieldNames
 }
 
-func ParseParam(f *ast.Field) *Param {
-	param := &Param{
-		RequiredImports: make(map[string]bool),
-	}
-
-	switch p := f.Type.(type) {
-	case *ast.SelectorExpr:
-		param.typeFromSelectorExpr(p)
-
-	case *ast.Ident:
-		param.typeFromIdent(p)
-
-	case *ast.StarExpr:
-		param.typeFromStarExpr(p)
+// Creates a param from a type checked func param or result, variadic params are rendered as ...Elem
+func ParamFromVar(v *types.Var, variadic bool, q types.Qualifier) (*Param, error) {
+	t, err := TypeFromGoType(v.Type(), q)
 
-	case *ast.ArrayType:
-		param.typeFromArray(p)
-
-	default:
-		panic("unhandled type")
+	if err != nil {
+		return nil, err
 	}
 
-	if len(f.Names) > 0 {
-		param.Name = f.Names[0].Name
+	if variadic {
+		t = &Type{Kind: EllipsisType, Elem: t.Elem}
 	}
 
-	return param
+	return &Param{Name: v.Name(), Type: t, goType: v.Type()}, nil
 }
 
-func (param *Param) typeFromSelectorExpr(sExp *ast.SelectorExpr) {
-	if sExp.X != nil {
-		ident := sExp.X.(*ast.Ident)
-		param.TypePackage = ident.Name
-		param.RequiredImports[ident.Name] = true
-	}
+// Exported struct field name used when the param is wrapped in an envelope
+func (param *Param) FieldName() string {
+	return param.field
+}
 
-	param.Type = sExp.Sel.Name
+// Sets unique exported field names for params wrapped in the same envelope, e.g. _id becomes
+// Id, and id and Id become Id and Id1
+func setFieldNames(params []*Param) {
+	used := make(map[string]bool)
 
-	if param.Name == "" {
-		param.Name = strings.ToLower(sExp.Sel.Name)
-	}
-}
+	for _, p := range params {
+		r := []rune(strings.TrimLeft(p.Name, "_"))
 
-func (param *Param) typeFromStarExpr(sExp *ast.StarExpr) {
-	param.Pointer = true
+		if len(r) > 0 {
+			r[0] = unicode.ToUpper(r[0])
+		}
 
-	switch sExp.X.(type) {
-	case *ast.Ident:
-		param.Type = sExp.X.(*ast.Ident).Name
-		param.Name = strings.ToLower(param.Type)
-	case *ast.SelectorExpr:
-		sExpX := sExp.X.(*ast.SelectorExpr)
-		param.typeFromSelectorExpr(sExpX)
-		param.Name = strings.ToLower(sExpX.Sel.Name)
+		// names starting with a digit or a letter without an upper case can't be exported
+		if len(r) == 0 || !unicode.IsUpper(r[0]) {
+			r = append([]rune("X"), r...)
+		}
 
-	default:
-		panic("unhandled type")
-	}
-}
+		name := string(r)
+		p.field = name
 
-func (param *Param) typeFromIdent(ident *ast.Ident) {
-	param.Type = ident.Name
+		for n := 1; used[p.field]; n++ {
+			p.field = fmt.Sprintf("%s%d", name, n)
+		}
 
-	if param.Name == "" {
-		param.Name = strings.ToLower(param.Name)
+		used[p.field] = true
 	}
 }
 
-func (param *Param) typeFromArray(arr *ast.ArrayType) {
-	param.Array = true
-
-	switch arr.Elt.(type) {
-	case *ast.SelectorExpr:
-		param.typeFromSelectorExpr(arr.Elt.(*ast.SelectorExpr))
-
-	case *ast.Ident:
-		param.typeFromIdent(arr.Elt.(*ast.Ident))
+// Whether the param is a plain string, which is sent over the wire as is
+func (param *Param) IsString() bool {
+	return param.Type.IsBuiltin("string")
+}
 
-	case *ast.StarExpr:
-		param.typeFromStarExpr(arr.Elt.(*ast.StarExpr))
+// Whether the param is the builtin error type
+func (param *Param) IsError() bool {
+	return param.Type.IsBuiltin("error")
+}
 
-	default:
-		panic("unhandled type")
-	}
+// Whether the param is variadic (e.g. tags ...string)
+func (param *Param) IsVariadic() bool {
+	return param.Type.Kind == EllipsisType
 }
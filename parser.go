@@ -1,31 +1,70 @@
 package autonats
 
 import (
-	"go/ast"
+	"bytes"
+	"errors"
+	"fmt"
 	"go/parser"
 	"go/token"
+	"golang.org/x/tools/go/packages"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 )
 
 // Parser config
 type ParserConfig struct {
-	BaseDir            string // Directory containing interfaces to scan
-	DefaultTimeout     int    // Timeout for NATS requests
-	OutputFileName     string // Output file name
-	DefaultConcurrency int    // Default handler concurrency
-	Tracing            bool   // Generate tracing code
+	DefaultTimeout     time.Duration // Timeout for NATS requests
+	OutputFileName     string        // Output file name
+	DefaultConcurrency int           // Default handler concurrency
+	Tracing            TracingMode   // Tracing instrumentation to generate
+	DefaultCodec       string        // Codec used by services without a @nats:codec annotation
+}
+
+// Tracing instrumentation generated for handlers and clients
+type TracingMode string
+
+const (
+	TracingNone        TracingMode = ""
+	TracingOpenTracing TracingMode = "opentracing" // OpenTracing spans propagated in NATS headers
+	TracingOTel        TracingMode = "otel"        // OpenTelemetry spans and metrics propagated in NATS headers
+)
+
+// Parses a tracing mode. Boolean values are accepted for backwards compatibility, true being OpenTracing.
+func ParseTracingMode(value string) (TracingMode, error) {
+	switch strings.ToLower(value) {
+	case "", "false", "none", "off":
+		return TracingNone, nil
+	case "true", "opentracing":
+		return TracingOpenTracing, nil
+	case "otel", "opentelemetry":
+		return TracingOTel, nil
+	}
+
+	return TracingNone, fmt.Errorf("unknown tracing mode %q, expected opentracing or otel", value)
 }
 
 // Parser object
 type Parser struct {
-	config      *ParserConfig
-	services    []*Service
-	rawPackages map[string]*ast.Package
-	packages    map[string]*Package
+	config   *ParserConfig
+	services []*Service
+	rawPkgs  []*packages.Package
+	packages map[string]*Package
 }
 
-func ParseDir(path string) (map[string]*ast.Package, error) {
-	fileSet := token.NewFileSet()
+const loadMode = packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles | packages.NeedImports |
+	packages.NeedTypes | packages.NeedTypesInfo | packages.NeedSyntax
+
+// Loads and type checks the packages matching pattern, which is a directory optionally followed
+// by /... to include every package below it (e.g. ./..., ./api/...). Like the go tool, the walk
+// skips vendor, testdata, directories starting with _ or . and nested modules. Previously
+// generated code in outFileName is replaced with an empty file so that stale output doesn't
+// break type checking. Packages are returned even if they have errors, see PackageDiagnostics.
+func ParseDir(pattern, outFileName string) ([]*packages.Package, error) {
+	path, recursive := splitPattern(pattern)
 
 	if !filepath.IsAbs(path) {
 		if baseDir, err := filepath.Abs(path); err != nil {
@@ -35,61 +74,230 @@ func ParseDir(path string) (map[string]*ast.Package, error) {
 		}
 	}
 
-	return parser.ParseDir(fileSet, path, nil, 4)
+	overlay, err := generatedOverlays(path, outFileName, recursive)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &packages.Config{
+		Mode:    loadMode,
+		Dir:     path,
+		Overlay: overlay,
+	}
+
+	query := "."
+
+	if recursive {
+		query = "./..."
+	}
+
+	pkgs, err := packages.Load(cfg, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pkgs, nil
+}
+
+// Splits a package pattern into its base directory and whether it ends with /..., optionally
+// followed by a slash
+func splitPattern(pattern string) (string, bool) {
+	slashed := strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+
+	if slashed == "..." {
+		return ".", true
+	}
+
+	if dir := strings.TrimSuffix(slashed, "/..."); dir != slashed {
+		if dir == "" {
+			dir = "/"
+		}
+
+		return filepath.FromSlash(dir), true
+	}
+
+	return pattern, false
+}
+
+// Returns overlays for the generated files in dir and, if recursive, in the directories below it
+func generatedOverlays(dir, outFileName string, recursive bool) (map[string][]byte, error) {
+	overlay := make(map[string][]byte)
+
+	if !recursive {
+		addGeneratedOverlay(overlay, dir, outFileName)
+		return overlay, nil
+	}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+
+		if path != dir && skipDir(path) {
+			return filepath.SkipDir
+		}
+
+		addGeneratedOverlay(overlay, path, outFileName)
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return overlay, nil
+}
+
+// Whether a directory is ignored by ./... patterns
+func skipDir(path string) bool {
+	name := filepath.Base(path)
+
+	if name == "vendor" || name == "testdata" || strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") {
+		return true
+	}
+
+	// nested modules aren't matched by the parent module's patterns
+	_, err := os.Stat(filepath.Join(path, "go.mod"))
+
+	return err == nil
+}
+
+// Replaces the generated file in dir, if any, with just its package clause
+func addGeneratedOverlay(overlay map[string][]byte, dir, outFileName string) {
+	outFile := filepath.Join(dir, outFileName)
+
+	if f, err := parser.ParseFile(token.NewFileSet(), outFile, nil, parser.PackageClauseOnly); err == nil {
+		overlay[outFile] = []byte(fmt.Sprintf("package %s\n", f.Name.Name))
+	}
+}
+
+// Converts the load, parse and type errors of a package into diagnostics
+func PackageDiagnostics(pkg *packages.Package) Diagnostics {
+	diags := make(Diagnostics, 0, len(pkg.Errors))
+	hasTypeErrors := false
+
+	for _, e := range pkg.Errors {
+		hasTypeErrors = hasTypeErrors || e.Kind != packages.ListError
+	}
+
+	for _, e := range pkg.Errors {
+		// go list repeats compile errors without positions
+		if hasTypeErrors && e.Kind == packages.ListError {
+			continue
+		}
+
+		diags = append(diags, &Diagnostic{
+			Pos:      parsePosition(e.Pos),
+			Severity: SeverityError,
+			Message:  e.Msg,
+		})
+	}
+
+	return diags
 }
 
 // Creates a new parser with the provided config
 func NewParser(config *ParserConfig) *Parser {
+	if config.DefaultCodec == "" {
+		config.DefaultCodec = DefaultCodec
+	}
+
 	return &Parser{
-		config:      config,
-		services:    make([]*Service, 0),
-		rawPackages: make(map[string]*ast.Package),
-		packages:    make(map[string]*Package),
+		config:   config,
+		services: make([]*Service, 0),
+		rawPkgs:  make([]*packages.Package, 0),
+		packages: make(map[string]*Package),
 	}
 }
 
-func (par *Parser) ParseDir(path string) error {
-	packages, err := ParseDir(path)
+// Loads the packages matching the provided directories or patterns, see ParseDir
+func (par *Parser) ParseDir(patterns ...string) error {
+	for _, pattern := range patterns {
+		pkgs, err := ParseDir(pattern, par.config.OutputFileName)
 
-	if err != nil {
-		return err
-	}
+		if err != nil {
+			return fmt.Errorf("%s: %s", pattern, err.Error())
+		}
 
-	par.AddRawPackages(packages)
+		par.AddPackages(pkgs)
+	}
 
 	return nil
 }
 
-func (par *Parser) AddRawPackages(packages map[string]*ast.Package) {
-	for k, v := range packages {
-		par.rawPackages[k] = v
+// Adds loaded packages to the parser, packages that were already added are ignored
+func (par *Parser) AddPackages(pkgs []*packages.Package) {
+	for _, pkg := range pkgs {
+		dup := false
+
+		for _, p := range par.rawPkgs {
+			dup = dup || p.ID == pkg.ID
+		}
+
+		if !dup {
+			par.rawPkgs = append(par.rawPkgs, pkg)
+		}
 	}
 }
 
-// Runs the parser and outputs generated code to file
-func (par *Parser) Run() {
+// Runs the parser and returns the problems found, sorted by position. Nothing should be
+// rendered if any of them is an error.
+func (par *Parser) Run() Diagnostics {
 	packages := make(map[string]*Package)
 	services := make([]*Service, 0)
+	diags := make(Diagnostics, 0)
+
+	for _, v := range par.rawPkgs {
+		if len(v.Errors) > 0 {
+			diags = append(diags, PackageDiagnostics(v)...)
+			continue
+		}
+
+		// import aliases are assigned per package, since each package gets its own output file
+		r := &Reporter{Fset: v.Fset}
 
-	for _, v := range par.rawPackages {
-		services = append(services, ServicesFromPkg(v)...)
+		for _, service := range ServicesFromPkg(v, newImportSet(), r) {
+			if service.Codec == "" {
+				service.Codec = par.config.DefaultCodec
+			}
+
+			service.validateCodec(r)
+			services = append(services, service)
+		}
+
+		diags = append(diags, r.Diagnostics...)
 	}
 
 	for _, service := range services {
-		pkg, ok := packages[service.FileName]
+		pkg, ok := packages[service.PackagePath]
 
 		if !ok {
 			pkg = PackageFromService(service)
-			packages[service.FileName] = pkg
+			packages[service.PackagePath] = pkg
+		}
+
+		if service.Timeout <= 0 {
+			service.Timeout = par.config.DefaultTimeout
+		}
+
+		if service.HandlerConcurrency <= 0 {
+			service.HandlerConcurrency = par.config.DefaultConcurrency
 		}
 
 		for _, m := range service.Methods {
 			if m.Timeout <= 0 {
-				m.Timeout = par.config.DefaultTimeout
+				m.Timeout = service.Timeout
 			}
 
 			if m.HandlerConcurrency <= 0 {
-				m.HandlerConcurrency = par.config.DefaultConcurrency
+				m.HandlerConcurrency = service.HandlerConcurrency
 			}
 		}
 
@@ -98,26 +306,159 @@ func (par *Parser) Run() {
 
 	par.services = services
 	par.packages = packages
+
+	diags.Sort()
+
+	return diags
 }
 
-func (par *Parser) Render() error {
-	imports := make([]string, 0)
+// Returns the data to render for each package, sorted by package path
+func (par *Parser) renderData() []*RenderData {
+	paths := make([]string, 0, len(par.packages))
+
+	for path := range par.packages {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	list := make([]*RenderData, len(paths))
 
-	for pk := range par.packages {
-		for k := range par.packages[pk].Imports {
-			imports = append(imports, k)
+	for i, path := range paths {
+		pkg := par.packages[path]
+
+		list[i] = &RenderData{
+			PackageName: pkg.Name,
+			FileName:    par.config.OutputFileName,
+			Path:        pkg.BaseDir,
+			Services:    pkg.Services,
+			Imports:     pkg.ImportList(),
+			Timeout:     par.config.DefaultTimeout,
+			Tracing:     par.config.Tracing,
+		}
+	}
+
+	return list
+}
+
+// Renders the services of each package into the output file in the package directory, and
+// removes the generated files of packages that no longer declare any services, returning
+// their paths
+func (par *Parser) Render() ([]string, error) {
+	list := par.renderData()
+	orphans, err := par.orphans()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) == 0 && len(orphans) == 0 {
+		return nil, errors.New("no data found to render")
+	}
+
+	for _, data := range list {
+		if err := Render(data); err != nil {
+			return nil, fmt.Errorf("%s: %s", data.OutFile(), err.Error())
 		}
 	}
 
-	data := RenderData{
-		FileName: par.config.OutputFileName,
-		Path:     par.config.BaseDir,
-		Services: par.services,
-		Imports:  imports,
-		Timeout:  par.config.DefaultTimeout,
-		JsonLib:  "jsoniter",
-		Tracing:  par.config.Tracing,
+	removed := make([]string, 0, len(orphans))
+
+	for _, f := range orphans {
+		if err := os.Remove(f.Path); err != nil {
+			return removed, fmt.Errorf("failed to remove file: %s", err.Error())
+		}
+
+		removed = append(removed, f.Path)
+	}
+
+	return removed, nil
+}
+
+// Returns the generated files of loaded packages that no longer declare any services,
+// which generate removes
+func (par *Parser) orphans() ([]*StaleFile, error) {
+	orphans := make([]*StaleFile, 0)
+
+	for _, pkg := range par.rawPkgs {
+		if _, ok := par.packages[pkg.PkgPath]; ok || len(pkg.GoFiles) == 0 {
+			continue
+		}
+
+		outFile := filepath.Join(packageDir(pkg, ""), par.config.OutputFileName)
+		current, err := ioutil.ReadFile(outFile)
+
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %s", err.Error())
+		}
+
+		// files that weren't generated by autonats are left alone
+		if bytes.HasPrefix(current, []byte(GeneratedHeader)) {
+			orphans = append(orphans, &StaleFile{Path: outFile, Current: current})
+		}
+	}
+
+	return orphans, nil
+}
+
+// Generated file that doesn't match the file on disk
+type StaleFile struct {
+	Path      string
+	Current   []byte // Contents on disk, nil if the file doesn't exist
+	Generated []byte // Generated contents, nil if the package has no services left and the file is removed
+}
+
+// Unified diff from the file on disk to the generated file, name is used to label both sides
+func (f *StaleFile) Diff(name string) string {
+	oldName, newName := "a/"+name, "b/"+name
+
+	if f.Current == nil {
+		oldName = "/dev/null"
+	}
+
+	if f.Generated == nil {
+		newName = "/dev/null"
+	}
+
+	return UnifiedDiff(oldName, newName, f.Current, f.Generated)
+}
+
+// Renders the services of each package in memory and returns the output files that are
+// missing or differ from the generated code, along with the generated files of packages
+// without services
+func (par *Parser) Check() ([]*StaleFile, error) {
+	list := par.renderData()
+	stale, err := par.orphans()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) == 0 && len(stale) == 0 {
+		return nil, errors.New("no data found to render")
+	}
+
+	for _, data := range list {
+		out, err := RenderSource(data)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", data.OutFile(), err.Error())
+		}
+
+		current, err := ioutil.ReadFile(data.OutFile())
+
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read file: %s", err.Error())
+		}
+
+		if !bytes.Equal(current, out) {
+			stale = append(stale, &StaleFile{Path: data.OutFile(), Current: current, Generated: out})
+		}
 	}
 
-	return Render(&data)
+	return stale, nil
 }
@@ -0,0 +1,148 @@
+package autonats
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Writes files given as path -> contents below dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParserOrphans(t *testing.T) {
+	dir := t.TempDir()
+	generated := GeneratedHeader + "\n\npackage old\n\nfunc Stale() {}\n"
+
+	writeFiles(t, dir, map[string]string{
+		"go.mod":                "module example.com/orphans\n\ngo 1.20\n",
+		"old/old.go":            "package old\n\n// services were removed from this package\ntype Service interface{}\n",
+		"old/nats_client.go":    generated,
+		"manual/manual.go":      "package manual\n",
+		"manual/nats_client.go": "package manual\n\n// not generated, left alone\n",
+	})
+
+	par := NewParser(&ParserConfig{OutputFileName: "nats_client.go"})
+
+	if err := par.ParseDir(filepath.Join(dir, "...")); err != nil {
+		t.Fatal(err)
+	}
+
+	if diags := par.Run(); diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+
+	stale, err := par.Check()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stale) != 1 {
+		t.Fatalf("got %d stale files, want 1", len(stale))
+	}
+
+	outFile := filepath.Join(dir, "old", "nats_client.go")
+
+	if stale[0].Path != outFile || stale[0].Generated != nil {
+		t.Fatalf("got stale file %s, want %s to be removed", stale[0].Path, outFile)
+	}
+
+	diff := stale[0].Diff("old/nats_client.go")
+
+	if !strings.HasPrefix(diff, "--- a/old/nats_client.go\n+++ /dev/null\n@@ -1,5 +0,0 @@\n-"+GeneratedHeader+"\n") {
+		t.Errorf("unexpected diff:\n%s", diff)
+	}
+
+	removed, err := par.Render()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(removed) != 1 || removed[0] != outFile {
+		t.Errorf("got removed files %v, want %s", removed, outFile)
+	}
+
+	if _, err = os.Stat(outFile); !os.IsNotExist(err) {
+		t.Errorf("%s wasn't removed", outFile)
+	}
+
+	if _, err = os.Stat(filepath.Join(dir, "manual", "nats_client.go")); err != nil {
+		t.Errorf("file that wasn't generated was removed: %s", err.Error())
+	}
+}
+
+func TestSplitPattern(t *testing.T) {
+	for _, tt := range []struct {
+		pattern   string
+		dir       string
+		recursive bool
+	}{
+		{"...", ".", true},
+		{".../", ".", true},
+		{"./...", ".", true},
+		{"./.../", ".", true},
+		{"/...", "/", true},
+		{"./api/...", "./api", true},
+		{"api/.../", "api", true},
+		{"/src/api/...", "/src/api", true},
+		{".", ".", false},
+		{"./api", "./api", false},
+		{"./api/", "./api/", false},
+		{"./api...", "./api...", false},
+	} {
+		dir, recursive := splitPattern(filepath.FromSlash(tt.pattern))
+
+		if dir != filepath.FromSlash(tt.dir) || recursive != tt.recursive {
+			t.Errorf("splitPattern(%q) = %q, %t, want %q, %t", tt.pattern, dir, recursive, tt.dir, tt.recursive)
+		}
+	}
+}
+
+func TestSkipDir(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFiles(t, dir, map[string]string{
+		"api/api.go":            "package api\n",
+		"api/vendor/v.go":       "package v\n",
+		"testdata/t.go":         "package t\n",
+		"_old/old.go":           "package old\n",
+		".cache/c.go":           "package c\n",
+		"nested/go.mod":         "module example.com/nested\n",
+		"nested/api/api.go":     "package api\n",
+		"api/internal/store.go": "package store\n",
+	})
+
+	for _, tt := range []struct {
+		path string
+		skip bool
+	}{
+		{"api", false},
+		{"api/internal", false},
+		{"api/vendor", true},
+		{"testdata", true},
+		{"_old", true},
+		{".cache", true},
+		{"nested", true},
+	} {
+		if got := skipDir(filepath.Join(dir, filepath.FromSlash(tt.path))); got != tt.skip {
+			t.Errorf("skipDir(%q) = %t, want %t", tt.path, got, tt.skip)
+		}
+	}
+}
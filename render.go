@@ -8,67 +8,110 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"sort"
+	"time"
 )
 
 type RenderData struct {
 	PackageName, FileName, Path string
 	Services                    []*Service
-	Imports                     []string
-	Timeout                     int
-	JsonLib                     string
-	Tracing                     bool
+	Imports                     []*Import
+	Timeout                     time.Duration
+	Tracing                     TracingMode
 }
 
-func Render(data *RenderData) error {
+// Whether to generate OpenTracing instrumentation
+func (data *RenderData) OpenTracing() bool {
+	return data.Tracing == TracingOpenTracing
+}
+
+// Whether to generate OpenTelemetry instrumentation
+func (data *RenderData) OTel() bool {
+	return data.Tracing == TracingOTel
+}
+
+// Adds an unaliased import unless it's already imported
+func (data *RenderData) addImport(path string) {
+	for _, imp := range data.Imports {
+		if imp.Path == path {
+			return
+		}
+	}
+
+	data.Imports = append(data.Imports, &Import{Path: path})
+}
+
+// Header of generated files, see https://golang.org/s/generatedcode
+const GeneratedHeader = "// Code generated by autonats. DO NOT EDIT."
+
+// Renders the generated code and returns the formatted source. If gofmt fails, the
+// unformatted source is returned along with the error to help debugging the template.
+func RenderSource(data *RenderData) ([]byte, error) {
 	if data == nil || len(data.Services) == 0 {
-		return errors.New("no data found to render")
+		return nil, errors.New("no data found to render")
 	}
 
-	data.Imports = append(data.Imports,
+	runtimeImports := []string{
 		"github.com/zyra/autonats",
 		"github.com/nats-io/nats.go",
 		"time",
-		"github.com/json-iterator/go",
-	)
+		"context",
+	}
 
-	if data.Tracing {
-		data.Imports = append(data.Imports,
-			"github.com/nats-io/not.go",
+	if data.OpenTracing() {
+		runtimeImports = append(runtimeImports,
 			"github.com/opentracing/opentracing-go",
 			"github.com/opentracing/opentracing-go/ext",
 			"github.com/opentracing/opentracing-go/log")
 	}
 
-	sort.Strings(data.Imports)
+	for _, path := range runtimeImports {
+		data.addImport(path)
+	}
+
+	sort.Slice(data.Imports, func(i, j int) bool {
+		return data.Imports[i].Path < data.Imports[j].Path
+	})
 	sort.Slice(data.Services, func(i, j int) bool {
 		return data.Services[i].Name < data.Services[j].Name
 	})
 
-	data.PackageName = data.Services[0].PackageName
-
-	data.Timeout = 5
-
-	outFile := filepath.Join(data.Path, data.FileName)
-
 	b := make([]byte, 0)
 	buff := bytes.NewBuffer(b)
 
 	err := tmplService.Execute(buff, data)
 
 	if err != nil {
-		return fmt.Errorf("failed to execute template: %s", err.Error())
+		return nil, fmt.Errorf("failed to execute template: %s", err.Error())
 	}
 
 	out, err := format.Source(buff.Bytes())
 
 	if err != nil {
-		_ = ioutil.WriteFile(outFile, buff.Bytes(), 0655)
-		return fmt.Errorf("failed to run gofmt on generated source: %s", err.Error())
+		return buff.Bytes(), fmt.Errorf("failed to run gofmt on generated source: %s", err.Error())
+	}
+
+	return out, nil
+}
+
+// Path of the generated file
+func (data *RenderData) OutFile() string {
+	return filepath.Join(data.Path, data.FileName)
+}
+
+func Render(data *RenderData) error {
+	out, err := RenderSource(data)
+
+	if err != nil {
+		if out != nil {
+			_ = ioutil.WriteFile(data.OutFile(), out, 0655)
+		}
+
+		return err
 	}
 
-	fmt.Printf("rendering data to %s\n", outFile)
+	fmt.Printf("rendering data to %s\n", data.OutFile())
 
-	if err := ioutil.WriteFile(outFile, out, 0655); err != nil {
+	if err := ioutil.WriteFile(data.OutFile(), out, 0655); err != nil {
 		return fmt.Errorf("failed to write file: %s", err.Error())
 	} else {
 		return nil
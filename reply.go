@@ -1,7 +1,9 @@
 package autonats
 
 import (
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"github.com/json-iterator/go"
 	"sync"
 )
@@ -22,16 +24,137 @@ func PutReply(reply *Reply) {
 }
 
 type Reply struct {
-	Data  []byte `json:"d,omitempty"`
-	Error []byte `json:"e,omitempty"`
+	Data    []byte `json:"d,omitempty"`
+	Error   []byte `json:"e,omitempty"`
+	Codec   string `json:"c,omitempty"` // Codec used to encode Data, empty for raw strings and legacy replies
+	Code    Code   `json:"-"`           // Error code
+	ErrorID string `json:"-"`           // Registered sentinel error, see RegisterError
+	Details []byte `json:"-"`           // JSON encoded error details
 }
 
+// Replies are framed as:
+//
+//	magic (1 byte) | version (1 byte) | flags (1 byte) | codec name length (1 byte) | codec name
+//	| error, if flagged | data
+//
+// Errors are encoded as a uvarint code followed by the message, sentinel ID and details, each
+// prefixed with its uvarint length. Data is sent as is, without being copied or base64 encoded
+// into another document.
+const (
+	replyMagic   = 0xa7 // Legacy JSON replies always start with '{'
+	replyVersion = 1
+
+	replyFlagStatus = 1 << 0 // Error with code, sentinel ID and details
+)
+
+var errTruncatedReply = errors.New("autonats: truncated reply")
+
 func (r *Reply) MarshalBinary() ([]byte, error) {
-	return jsoniter.Marshal(r)
+	if len(r.Codec) > 255 {
+		return nil, fmt.Errorf("autonats: codec name %s is too long", r.Codec)
+	}
+
+	size := 4 + len(r.Codec) + len(r.Data)
+
+	if r.Error != nil {
+		size += 4*binary.MaxVarintLen64 + len(r.Error) + len(r.ErrorID) + len(r.Details)
+	}
+
+	b := make([]byte, 0, size)
+	b = append(b, replyMagic, replyVersion, 0, byte(len(r.Codec)))
+	b = append(b, r.Codec...)
+
+	if r.Error != nil {
+		b[2] |= replyFlagStatus
+		b = binary.AppendUvarint(b, uint64(r.Code))
+		b = appendBytes(b, r.Error)
+		b = appendBytes(b, []byte(r.ErrorID))
+		b = appendBytes(b, r.Details)
+	}
+
+	return append(b, r.Data...), nil
 }
 
+func appendBytes(b, value []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+// Reads a uvarint length prefixed value, returning the value and the remaining data
+func readBytes(data []byte) ([]byte, []byte, error) {
+	n, read := binary.Uvarint(data)
+
+	if read <= 0 || uint64(len(data)-read) < n {
+		return nil, nil, errTruncatedReply
+	}
+
+	return data[read : read+int(n)], data[read+int(n):], nil
+}
+
+// Reads a binary reply, or a JSON reply sent by handlers generated with previous versions.
+// Data and Error point into data, which must not be modified while the reply is used.
 func (r *Reply) UnmarshalBinary(data []byte) error {
-	return jsoniter.Unmarshal(data, r)
+	if len(data) > 0 && data[0] == '{' {
+		return jsoniter.Unmarshal(data, r)
+	}
+
+	if len(data) < 4 || data[0] != replyMagic {
+		return errors.New("autonats: invalid reply")
+	}
+
+	if data[1] != replyVersion {
+		return fmt.Errorf("autonats: unsupported reply version %d", data[1])
+	}
+
+	flags := data[2]
+	n := int(data[3])
+	data = data[4:]
+
+	if len(data) < n {
+		return errTruncatedReply
+	}
+
+	r.Codec = string(data[:n])
+	data = data[n:]
+
+	var err error
+
+	if flags&replyFlagStatus != 0 {
+		code, read := binary.Uvarint(data)
+
+		if read <= 0 {
+			return errTruncatedReply
+		}
+
+		r.Code = Code(code)
+		data = data[read:]
+
+		var id []byte
+
+		if r.Error, data, err = readBytes(data); err != nil {
+			return err
+		}
+
+		if id, data, err = readBytes(data); err != nil {
+			return err
+		}
+
+		if r.Details, data, err = readBytes(data); err != nil {
+			return err
+		}
+
+		r.ErrorID = string(id)
+
+		if len(r.Details) == 0 {
+			r.Details = nil
+		}
+	}
+
+	if len(data) > 0 {
+		r.Data = data
+	}
+
+	return nil
 }
 
 func (r *Reply) WriteString(data string) {
@@ -42,24 +165,50 @@ func (r *Reply) SetData(data []byte) {
 	r.Data = data
 }
 
+// Encodes the reply data with the named codec
+func (r *Reply) Encode(codecName string, data interface{}) error {
+	codec, err := GetCodec(codecName)
+
+	if err != nil {
+		return err
+	}
+
+	if r.Data, err = codec.Marshal(data); err != nil {
+		return err
+	}
+
+	r.Codec = codecName
+
+	return nil
+}
+
+// Decodes the reply data with the named codec, replies encoded with another codec return a CodecMismatchError
+func (r *Reply) Decode(codecName string, vPtr interface{}) error {
+	if r.Codec != "" && r.Codec != codecName {
+		return &CodecMismatchError{Got: r.Codec, Want: codecName}
+	}
+
+	codec, err := GetCodec(codecName)
+
+	if err != nil {
+		return err
+	}
+
+	return codec.Unmarshal(r.Data, vPtr)
+}
+
+// Deprecated: use Encode
 func (r *Reply) MarshalAndSetData(data interface{}) error {
 	var err error
 	r.Data, err = jsoniter.Marshal(data)
 	return err
 }
 
-func (r *Reply) GetError() error {
-	if r.Error == nil {
-		return nil
-	} else {
-		return errors.New(string(r.Error))
-	}
-}
-
 func (r *Reply) GetDataAsString() string {
 	return string(r.Data)
 }
 
+// Deprecated: use Decode
 func (r *Reply) UnmarshalData(vPtr interface{}) error {
 	if vPtr == nil {
 		return nil
@@ -71,4 +220,8 @@ func (r *Reply) UnmarshalData(vPtr interface{}) error {
 func (r *Reply) Reset() {
 	r.Data = nil
 	r.Error = nil
+	r.Codec = ""
+	r.Code = OK
+	r.ErrorID = ""
+	r.Details = nil
 }
@@ -0,0 +1,212 @@
+package autonats
+
+import (
+	"bytes"
+	"errors"
+	"github.com/json-iterator/go"
+	"testing"
+)
+
+func testReplyPayload() []byte {
+	payload := make([]byte, 4096)
+
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+
+	return payload
+}
+
+func TestReplyRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply Reply
+	}{
+		{"empty", Reply{}},
+		{"data", Reply{Data: []byte("hello"), Codec: "json"}},
+		{"binary data", Reply{Data: testReplyPayload(), Codec: "cbor"}},
+		{"error", Reply{Error: []byte("not found"), Code: NotFound}},
+		{"error with details", Reply{Error: []byte("invalid"), Code: InvalidArgument, ErrorID: "invalid", Details: []byte(`{"field":"id"}`)}},
+		{"error with empty message", Reply{Error: []byte{}, Code: Internal}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.reply.MarshalBinary()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got Reply
+
+			if err = got.UnmarshalBinary(data); err != nil {
+				t.Fatal(err)
+			}
+
+			assertReply(t, &got, &tt.reply)
+		})
+	}
+}
+
+func TestReplyLegacyJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want Reply
+	}{
+		{"empty", `{}`, Reply{}},
+		{"data", `{"d":"aGVsbG8="}`, Reply{Data: []byte("hello")}},
+		{"data with codec", `{"d":"aGVsbG8=","c":"json"}`, Reply{Data: []byte("hello"), Codec: "json"}},
+		{"error", `{"e":"Zm9v"}`, Reply{Error: []byte("foo")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Reply
+
+			if err := got.UnmarshalBinary([]byte(tt.data)); err != nil {
+				t.Fatal(err)
+			}
+
+			assertReply(t, &got, &tt.want)
+		})
+	}
+
+	var reply Reply
+
+	if err := reply.UnmarshalBinary([]byte(`{"e":"Zm9v"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := CodeOf(reply.GetError()); code != Unknown {
+		t.Errorf("legacy error has code %s, want %s", code, Unknown)
+	}
+}
+
+func TestReplyTruncated(t *testing.T) {
+	full := Reply{Error: []byte("invalid"), Code: InvalidArgument, ErrorID: "invalid", Details: []byte(`{"field":"id"}`), Codec: "json"}
+	data, err := full.MarshalBinary()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every prefix of an error reply lacks part of the header or of the error
+	for n := 0; n < len(data); n++ {
+		var got Reply
+
+		if err := got.UnmarshalBinary(data[:n]); err == nil {
+			t.Errorf("reply truncated to %d of %d bytes was read without error", n, len(data))
+		}
+	}
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"bad magic", []byte{0x00, replyVersion, 0, 0}},
+		{"bad version", []byte{replyMagic, replyVersion + 1, 0, 0}},
+		{"codec past end", []byte{replyMagic, replyVersion, 0, 4, 'j'}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Reply
+
+			if err := got.UnmarshalBinary(tt.data); err == nil {
+				t.Error("invalid reply was read without error")
+			}
+		})
+	}
+
+	var got Reply
+
+	if err := got.UnmarshalBinary([]byte{replyMagic, replyVersion, 0, 4, 'j'}); !errors.Is(err, errTruncatedReply) {
+		t.Errorf("got %v, want %v", err, errTruncatedReply)
+	}
+}
+
+func assertReply(t *testing.T, got, want *Reply) {
+	t.Helper()
+
+	if !bytes.Equal(got.Data, want.Data) {
+		t.Errorf("data = %q, want %q", got.Data, want.Data)
+	}
+
+	if (got.Error == nil) != (want.Error == nil) || !bytes.Equal(got.Error, want.Error) {
+		t.Errorf("error = %q, want %q", got.Error, want.Error)
+	}
+
+	if got.Codec != want.Codec {
+		t.Errorf("codec = %q, want %q", got.Codec, want.Codec)
+	}
+
+	if got.Code != want.Code {
+		t.Errorf("code = %s, want %s", got.Code, want.Code)
+	}
+
+	if got.ErrorID != want.ErrorID {
+		t.Errorf("error id = %q, want %q", got.ErrorID, want.ErrorID)
+	}
+
+	if !bytes.Equal(got.Details, want.Details) {
+		t.Errorf("details = %q, want %q", got.Details, want.Details)
+	}
+}
+
+func BenchmarkReplyMarshal(b *testing.B) {
+	reply := &Reply{Data: testReplyPayload(), Codec: "cbor"}
+
+	b.Run("json", func(b *testing.B) {
+		benchmarkReply(b, func() ([]byte, error) { return jsoniter.Marshal(reply) })
+	})
+
+	b.Run("binary", func(b *testing.B) {
+		benchmarkReply(b, reply.MarshalBinary)
+	})
+}
+
+func BenchmarkReplyUnmarshal(b *testing.B) {
+	reply := &Reply{Data: testReplyPayload(), Codec: "cbor"}
+
+	b.Run("json", func(b *testing.B) {
+		data, _ := jsoniter.Marshal(reply)
+		benchmarkReplyRead(b, data)
+	})
+
+	b.Run("binary", func(b *testing.B) {
+		data, _ := reply.MarshalBinary()
+		benchmarkReplyRead(b, data)
+	})
+}
+
+func benchmarkReply(b *testing.B, marshal func() ([]byte, error)) {
+	b.ReportAllocs()
+
+	var size int
+
+	for i := 0; i < b.N; i++ {
+		data, err := marshal()
+
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		size = len(data)
+	}
+
+	b.ReportMetric(float64(size), "bytes/reply")
+}
+
+func benchmarkReplyRead(b *testing.B, data []byte) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		var reply Reply
+
+		if err := reply.UnmarshalBinary(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportMetric(float64(len(data)), "bytes/reply")
+}
@@ -0,0 +1,120 @@
+package autonats
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Codes of the calls retried by policies that don't set RetryableCodes
+var DefaultRetryableCodes = []Code{Unavailable, ResourceExhausted, Aborted}
+
+// Default values of the retry policy fields that are left empty
+const (
+	DefaultInitialBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff     = 5 * time.Second
+	DefaultBackoffFactor  = 2
+	DefaultJitter         = 0.2
+)
+
+// Retries failed calls of a client with exponential backoff. Every attempt is bound by the
+// method timeout, and no attempt is made once the call context is done.
+type RetryPolicy struct {
+	MaxAttempts    int           // Attempts including the first one, retries are disabled below 2
+	InitialBackoff time.Duration // Delay before the first retry
+	MaxBackoff     time.Duration // Upper bound of the delay between attempts
+	BackoffFactor  float64       // Factor the delay is multiplied by after each retry
+	Jitter         float64       // Fraction of each delay that's randomized, between 0 and 1
+	RetryableCodes []Code        // Codes of the errors that are retried, see DefaultRetryableCodes
+}
+
+// Returns the delay before the given retry, starting at 1
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	initial, max, factor, jitter := p.InitialBackoff, p.MaxBackoff, p.BackoffFactor, p.Jitter
+
+	if initial <= 0 {
+		initial = DefaultInitialBackoff
+	}
+
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+
+	if factor < 1 {
+		factor = DefaultBackoffFactor
+	}
+
+	if jitter <= 0 || jitter > 1 {
+		jitter = DefaultJitter
+	}
+
+	d := math.Min(float64(initial)*math.Pow(factor, float64(retry-1)), float64(max))
+
+	// spread the retries of concurrent callers, so they don't hit a recovering service at once
+	d += d * jitter * (2*rand.Float64() - 1)
+
+	return time.Duration(d)
+}
+
+// Whether a failed call is retried by the policy
+func (p *RetryPolicy) retryable(err error) bool {
+	codes := p.RetryableCodes
+
+	if len(codes) == 0 {
+		codes = DefaultRetryableCodes
+	}
+
+	code := CodeOf(err)
+
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns an invoker retrying invoker with the policy
+func (p *RetryPolicy) invoker(invoker UnaryInvoker) UnaryInvoker {
+	if p == nil || p.MaxAttempts < 2 {
+		return invoker
+	}
+
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		for attempt := 1; ; attempt++ {
+			resp, err := invoker(ctx, req)
+
+			// calls rejected by an open circuit breaker would be rejected again, even by policies
+			// that retry their code
+			if err == nil || attempt >= p.MaxAttempts || !p.retryable(err) || errors.Is(err, ErrCircuitOpen) {
+				return resp, err
+			}
+
+			timer := time.NewTimer(p.backoff(attempt))
+
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return resp, err
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// Returns the retry policy of a method, which is its own policy, the default policy or the
+// policy of its annotations, in that order
+func (o *ClientOptions) retryPolicy(method string) *RetryPolicy {
+	if p, ok := o.MethodRetry[method]; ok {
+		return p
+	}
+
+	if o.Retry != nil {
+		return o.Retry
+	}
+
+	return o.AnnotatedRetry[method]
+}
@@ -0,0 +1,81 @@
+package autonats
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyPrecedence(t *testing.T) {
+	annotated := RetryPolicy{MaxAttempts: 2}
+	global := RetryPolicy{MaxAttempts: 3}
+	method := RetryPolicy{MaxAttempts: 4}
+
+	tests := []struct {
+		name string
+		opts []ClientOption
+		want int // MaxAttempts of the policy used by Charge, 0 if none
+	}{
+		{"none", nil, 0},
+		{"annotated", []ClientOption{WithAnnotatedRetryPolicy("Charge", annotated)}, 2},
+		{"annotated other method", []ClientOption{WithAnnotatedRetryPolicy("Refund", annotated)}, 0},
+		{"default over annotated", []ClientOption{WithAnnotatedRetryPolicy("Charge", annotated), WithRetryPolicy(global)}, 3},
+		{"default before annotated", []ClientOption{WithRetryPolicy(global), WithAnnotatedRetryPolicy("Charge", annotated)}, 3},
+		{"method over default", []ClientOption{WithAnnotatedRetryPolicy("Charge", annotated), WithRetryPolicy(global), WithMethodRetryPolicy("Charge", method)}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewClientOptions(tt.opts...).retryPolicy("Charge")
+			got := 0
+
+			if p != nil {
+				got = p.MaxAttempts
+			}
+
+			if got != tt.want {
+				t.Errorf("got a policy with %d attempts, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryInvoker(t *testing.T) {
+	circuitOpen := &Error{Code: FailedPrecondition, cause: ErrCircuitOpen}
+
+	tests := []struct {
+		name     string
+		codes    []Code
+		errs     []error
+		attempts int
+		code     Code
+	}{
+		{"success", nil, []error{nil}, 1, OK},
+		{"retried until success", nil, []error{NewError(Unavailable, ""), nil}, 2, OK},
+		{"attempts exhausted", nil, []error{NewError(Unavailable, ""), NewError(Aborted, ""), NewError(Unavailable, "")}, 3, Unavailable},
+		{"not retryable", nil, []error{NewError(NotFound, "")}, 1, NotFound},
+		{"circuit open", nil, []error{circuitOpen}, 1, FailedPrecondition},
+		{"circuit open with its code retryable", []Code{FailedPrecondition}, []error{circuitOpen}, 1, FailedPrecondition},
+		{"code of open circuits retryable", []Code{FailedPrecondition}, []error{NewError(FailedPrecondition, ""), nil}, 2, OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, RetryableCodes: tt.codes}
+			attempts := 0
+
+			_, err := p.invoker(func(ctx context.Context, req interface{}) (interface{}, error) {
+				attempts++
+				return nil, tt.errs[attempts-1]
+			})(context.Background(), nil)
+
+			if attempts != tt.attempts {
+				t.Errorf("made %d attempts, want %d", attempts, tt.attempts)
+			}
+
+			if code := CodeOf(err); code != tt.code {
+				t.Errorf("got code %s, want %s", code, tt.code)
+			}
+		})
+	}
+}
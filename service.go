@@ -1,194 +1,282 @@
 package autonats
 
 import (
-	"fmt"
 	"go/ast"
-	"log"
+	"go/token"
+	"go/types"
+	"golang.org/x/tools/go/packages"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"time"
 )
 
-const DocPrefix = "@nats:"
-
 type Service struct {
-	InterfaceID string
+	InterfaceID        string
+	Name               string
+	Methods            []*Method
+	Imports            map[string]string
+	Basedir            string
+	PackageName        string
+	PackagePath        string
+	FileName           string        // File that declares the service
+	HandlerConcurrency int           // Default handler concurrency for the service methods
+	Timeout            time.Duration // Default timeout for the service methods
+	Codec              string        // Codec used to encode args and results
+	Events             bool          // Event service, see @nats:events
+}
+
+type ServiceConfig struct {
 	Name        string
-	Methods     []*Method
-	Imports     map[string]string
-	Basedir     string
-	PackageName string
-	FileName    string
+	Timeout     time.Duration
+	Concurrency int
+	Codec       string
+	Events      bool
 }
 
-func (svc *Service) combineImports(with []*ast.ImportSpec) {
-	imports := make(map[string]bool)
+// Reads the service config from the annotations on the interface declaration
+func ServiceConfigFromDoc(doc *ast.CommentGroup, r *Reporter) ServiceConfig {
+	args := parseAnnotations(doc)
+	args.checkKnown(r, "server", "events", "timeout", "concurrency", "codec")
 
-	for _, m := range svc.Methods {
-		for k := range m.imports {
-			imports[k] = true
-		}
+	config := ServiceConfig{
+		Timeout:     args.duration(r, "timeout"),
+		Concurrency: args.concurrency(r, "concurrency"),
 	}
 
-	for k := range imports {
-		var name, path string
-
-		for _, i := range with {
-			if i.Name != nil {
-				if i.Name.Name == k {
-					name = i.Name.Name
-					path = i.Path.Value
-					break
-				}
-			} else {
-				valSplit := strings.Split(strings.ReplaceAll(i.Path.Value, "\"", ""), "/")
-				if valSplit[len(valSplit)-1] == k {
-					path = i.Path.Value
-					break
-				}
-			}
+	if a, ok := args["codec"]; ok {
+		if a.Value == "" {
+			r.Errorf(a.Pos, "%scodec requires a codec name", DocPrefix)
+		} else if !IsBuiltinCodec(a.Value) {
+			r.Warnf(a.Pos, "%s is not a built-in codec, it must be registered with autonats.RegisterCodec", a.Value)
 		}
 
-		if path == "" {
-			panic("empty path!")
+		config.Codec = a.Value
+	}
+
+	a, isServer := args["server"]
+
+	if events, ok := args["events"]; ok {
+		if isServer {
+			r.Errorf(events.Pos, "%sevents can't be combined with %sserver", DocPrefix, DocPrefix)
 		}
 
-		path = strings.ReplaceAll(path, "\"", "")
+		a = events
+		config.Events = true
+	}
 
-		svc.Imports[path] = name
+	if a == nil {
+		r.Errorf(doc.Pos(), "missing %sserver or %sevents annotation", DocPrefix, DocPrefix)
+	} else if a.Value == "" {
+		r.Errorf(a.Pos, "%s%s requires a service name", DocPrefix, a.Key)
+	} else if !token.IsIdentifier(a.Value) {
+		r.Errorf(a.Pos, "invalid service name %q: must be a valid Go identifier", a.Value)
+	} else {
+		config.Name = a.Value
 	}
-}
 
-type ServiceConfig struct {
-	Name    string
-	Timeout time.Duration
+	return config
 }
 
-func ServiceConfigFromDoc(doc *ast.CommentGroup) ServiceConfig {
-	text := doc.Text()
-
-	rgx := regexp.MustCompile(fmt.Sprintf(`(?im)%s([a-z0-9-_]+)\s([a-z0-9-_]+)`, DocPrefix))
-	matches := rgx.FindAllSubmatch([]byte(text), -1)
+// Finds the annotated interfaces in a file. Problems are reported to r, and services that
+// can't be generated are skipped.
+func ServicesFromFile(pkg *packages.Package, fileName string, file *ast.File, imports *importSet, r *Reporter) []*Service {
+	services := make([]*Service, 0)
 
-	args := make(map[string][]string)
+	for _, d := range file.Decls {
+		decl, ok := d.(*ast.GenDecl)
 
-	for _, match := range matches {
-		if len(match) < 3 {
-			// line is too short to be ours
+		if !ok || decl.Doc == nil || len(parseAnnotations(decl.Doc)) == 0 {
 			continue
 		}
 
-		ar := make([]string, len(match)-2)
-		key := string(match[1])
-		args[key] = ar
+		typeSpec, iface, ok := findServiceIface(decl, r)
 
-		for ai, a := range match[2:] {
-			ar[ai] = string(a)
+		if !ok {
+			continue
 		}
-	}
 
-	return ServiceConfig{
-		Name:    args["server"][0],
-		Timeout: time.Second * 3,
-	}
-}
-
-func ServicesFromFile(pkgName, fileName string, file *ast.File) []*Service {
-	services := make([]*Service, 0)
+		errCount := len(r.Diagnostics)
+		svcConfig := ServiceConfigFromDoc(decl.Doc, r)
 
-	ast.Inspect(file, func(node ast.Node) bool {
-		if node == nil {
-			return false
+		service := Service{
+			InterfaceID:        typeSpec.Name.Name,
+			Name:               svcConfig.Name,
+			Imports:            make(map[string]string),
+			Basedir:            packageDir(pkg, fileName),
+			FileName:           fileName,
+			PackageName:        pkg.Name,
+			PackagePath:        pkg.PkgPath,
+			HandlerConcurrency: svcConfig.Concurrency,
+			Timeout:            svcConfig.Timeout,
+			Codec:              svcConfig.Codec,
+			Events:             svcConfig.Events,
 		}
 
-		decl, ok, val := findServiceDecl(node)
+		obj, ok := pkg.TypesInfo.Defs[typeSpec.Name].(*types.TypeName)
 
 		if !ok {
-			return val
+			r.Errorf(typeSpec.Pos(), "%s: missing type information", typeSpec.Name.Name)
+			continue
 		}
 
-		typeSpec, ok := decl.Specs[0].(*ast.TypeSpec)
+		ms := newMethodSet(pkg, imports.qualifier(pkg.Types, service.Imports), r)
+		ms.addInterface(obj.Type().Underlying().(*types.Interface), iface, typeSpec.Name.Name)
 
-		if !ok {
-			log.Println("invalid spec type")
-			return false
+		if len(ms.methods) == 0 {
+			if !r.Diagnostics[errCount:].HasErrors() {
+				r.Warnf(typeSpec.Pos(), "interface %s has no methods, skipping", typeSpec.Name.Name)
+			}
+
+			continue
 		}
 
-		iface, ok := findServiceIface(typeSpec)
+		service.Methods = ms.methods
 
-		if !ok {
-			return false
+		if service.Events {
+			service.validateEvents(r)
 		}
 
-		svcConfig := ServiceConfigFromDoc(decl.Doc)
+		services = append(services, &service)
+	}
 
-		methods := make([]*Method, iface.Methods.NumFields())
+	return services
+}
 
-		for i, m := range iface.Methods.List {
-			methods[i] = MethodFromField(m)
+// Reports methods that aren't events, which take a single payload and return nothing or an
+// error. Events are published as fire-and-forget calls.
+func (service *Service) validateEvents(r *Reporter) {
+	for _, m := range service.Methods {
+		if len(m.Args()) != 1 {
+			r.Errorf(m.pos, "event %s must take a single payload after the context", m.Name)
 		}
 
-		service := Service{
-			InterfaceID: typeSpec.Name.Name,
-			Name:        svcConfig.Name,
-			Methods:     methods,
-			Imports:     make(map[string]string),
-			Basedir:     filepath.Dir(fileName),
-			FileName:    file.Name.Name,
-			PackageName: pkgName,
+		if m.HasResult() {
+			r.Errorf(m.pos, "event %s can't return values", m.Name)
 		}
 
-		service.combineImports(file.Imports)
+		if m.Durable {
+			r.Errorf(m.pos, "event %s can't be %sdurable, events are delivered to every subscriber", m.Name, DocPrefix)
+		}
 
-		services = append(services, &service)
+		m.Async = true
+	}
+}
 
-		return true
-	})
+// Whether any method has a retry policy, which clients are created with
+func (service *Service) HasRetries() bool {
+	for _, m := range service.Methods {
+		if m.Retry != nil {
+			return true
+		}
+	}
 
-	return services
+	return false
 }
 
-func findServiceDecl(node ast.Node) (decl *ast.GenDecl, ok, value bool) {
-	decl, ok = node.(*ast.GenDecl)
+// Name of the interface implemented by servers. Event subscribers implement the annotated
+// interface itself, which isn't copied since it has no envelopes.
+func (service *Service) ServerName() string {
+	if service.Events {
+		return service.InterfaceID
+	}
 
-	if !ok {
-		return nil, false, true
+	return service.Name + "Server"
+}
+
+// Name of the generated handler type, which is unexported
+func (service *Service) HandlerName() string {
+	if service.Events {
+		return strings.ToLower(service.Name) + "Subscriber"
 	}
 
-	if decl.Doc == nil || !strings.Contains(decl.Doc.Text(), DocPrefix) {
-		return nil, false, false
+	return strings.ToLower(service.Name) + "Handler"
+}
+
+// Name of the generated client type, which publishes events for event services
+func (service *Service) ClientName() string {
+	if service.Events {
+		return service.Name + "Publisher"
 	}
 
-	if len(decl.Specs) != 1 {
-		log.Println("invalid number of specs")
-		return nil, false, false
+	return service.Name + "Client"
+}
+
+// Reports methods that can't be encoded with the service codec. Protobuf can only encode
+// single messages, so methods can't have multiple args or values.
+func (service *Service) validateCodec(r *Reporter) {
+	if service.Codec != "protobuf" {
+		return
 	}
 
-	return decl, true, false
+	for _, m := range service.Methods {
+		if m.RequestEnvelope() || m.ResponseEnvelope() {
+			r.Errorf(m.pos, "method %s: the protobuf codec requires a single arg and a single value", m.Name)
+			continue
+		}
+
+		for _, p := range append(m.Args(), m.Values()...) {
+			if !p.IsString() && !isProtoMessage(p.goType) {
+				r.Errorf(m.pos, "method %s: %s doesn't implement proto.Message, which is required by the protobuf codec", m.Name, p.Type)
+			}
+		}
+	}
 }
 
-func findServiceIface(typeSpec *ast.TypeSpec) (*ast.InterfaceType, bool) {
+// Whether t implements proto.Message, which is checked by its ProtoReflect method
+func isProtoMessage(t types.Type) bool {
+	if t == nil {
+		return false
+	}
+
+	ms := types.NewMethodSet(t)
+
+	for i := 0; i < ms.Len(); i++ {
+		if ms.At(i).Obj().Name() == "ProtoReflect" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the interface declared by an annotated type declaration
+func findServiceIface(decl *ast.GenDecl, r *Reporter) (*ast.TypeSpec, *ast.InterfaceType, bool) {
+	if decl.Tok != token.TYPE {
+		r.Errorf(decl.Pos(), "%s annotations are only supported on interface declarations", DocPrefix)
+		return nil, nil, false
+	}
+
+	if len(decl.Specs) != 1 {
+		r.Errorf(decl.Pos(), "annotated type declaration must declare exactly one interface, found %d", len(decl.Specs))
+		return nil, nil, false
+	}
+
+	typeSpec := decl.Specs[0].(*ast.TypeSpec)
 	iface, ok := typeSpec.Type.(*ast.InterfaceType)
 
 	if !ok {
-		log.Println("couldn't find an interface")
-		return nil, false
+		r.Errorf(typeSpec.Pos(), "%s is not an interface", typeSpec.Name.Name)
+		return nil, nil, false
 	}
 
-	if iface.Methods.NumFields() == 0 {
-		log.Println("interface has no methods")
-		return nil, false
+	return typeSpec, iface, true
+}
+
+// Returns the source directory of a package. Compiled files can live in the build cache.
+func packageDir(pkg *packages.Package, fileName string) string {
+	if len(pkg.GoFiles) > 0 {
+		return filepath.Dir(pkg.GoFiles[0])
 	}
 
-	return iface, true
+	return filepath.Dir(fileName)
 }
 
-func ServicesFromPkg(v *ast.Package) []*Service {
+// Finds the annotated interfaces in a package
+func ServicesFromPkg(pkg *packages.Package, imports *importSet, r *Reporter) []*Service {
 	services := make([]*Service, 0)
 
-	for fk, fv := range v.Files {
-		services = append(services, ServicesFromFile(v.Name, fk, fv)...)
+	for i, file := range pkg.Syntax {
+		services = append(services, ServicesFromFile(pkg, pkg.CompiledGoFiles[i], file, imports, r)...)
 	}
 
 	return services
@@ -5,39 +5,86 @@ import (
 	"reflect"
 	"strings"
 	"text/template"
+	"time"
 )
 
 func isLastItem(array interface{}, index int) bool {
 	return index == reflect.ValueOf(array).Len()-1
 }
 
+var durationUnits = []struct {
+	unit time.Duration
+	name string
+}{
+	{time.Hour, "time.Hour"},
+	{time.Minute, "time.Minute"},
+	{time.Second, "time.Second"},
+	{time.Millisecond, "time.Millisecond"},
+	{time.Microsecond, "time.Microsecond"},
+}
+
+// Renders a duration as a readable Go expression (e.g. 750 * time.Millisecond)
+func durationExpr(d time.Duration) string {
+	for _, u := range durationUnits {
+		if d >= u.unit && d%u.unit == 0 {
+			return fmt.Sprintf("%d * %s", d/u.unit, u.name)
+		}
+	}
+
+	return fmt.Sprintf("time.Duration(%d)", int64(d))
+}
+
+// Renders a code as the name of its constant (e.g. autonats.NotFound)
+func codeExpr(c Code) string {
+	if c == OK {
+		return "autonats.OK"
+	}
+
+	name := "autonats."
+
+	for _, word := range strings.Split(c.String(), "_") {
+		name += strings.ToUpper(word[:1]) + word[1:]
+	}
+
+	return name
+}
+
+// Service and method passed to templates rendering a method
+type methodArgs struct {
+	Service *Service
+	Method  *Method
+}
+
 var funMap = template.FuncMap{
-	"last":  isLastItem,
-	"lower": strings.ToLower,
+	"last":     isLastItem,
+	"lower":    strings.ToLower,
+	"duration": durationExpr,
+	"codeExpr": codeExpr,
 	"subject": func(srv *Service, method *Method) string {
-		return fmt.Sprintf("autonats.%s.%s", srv.Name, method.Name)
-	},
-	"returnPointer": func(result *Param) bool {
-		return !result.Array && result.Pointer
-	},
-	"nilResult": func(result *Param) string {
-		if result.Array {
-			return `nil`
+		if srv.Events {
+			return fmt.Sprintf("autonats.events.%s.%s", srv.Name, method.Name)
 		}
 
-		switch result.Type {
-		case "int", "int32", "int64", "uint8", "uint16", "uint32", "uint64", "float", "float64", "byte":
-			return "0"
-		case "bool":
-			return "false"
-		case "string":
-			return `""`
+		if method.Durable {
+			return DurableSubject(srv.Name, method.Name)
 		}
 
-		return "nil"
+		return fmt.Sprintf("autonats.%s.%s", srv.Name, method.Name)
+	},
+	"requestType": func(srv *Service, method *Method) string {
+		return fmt.Sprintf("%s%sRequest", strings.ToLower(srv.Name), method.Name)
+	},
+	"responseType": func(srv *Service, method *Method) string {
+		return fmt.Sprintf("%s%sResponse", strings.ToLower(srv.Name), method.Name)
+	},
+	"args": func(srv *Service, method *Method) methodArgs {
+		return methodArgs{Service: srv, Method: method}
 	},
-	"combine": func(strs ...string) string {
-		return strings.Join(strs, "")
+	"generatedHeader": func() string {
+		return GeneratedHeader
+	},
+	"jsonTag": func(name string) string {
+		return fmt.Sprintf("`json:%q`", name)
 	},
 }
 
@@ -46,7 +93,7 @@ var tmplService = template.Must(
 {{- define "params" }}
     {{- $method := . }}
     {{- range $pi, $p := $method.Params -}}
-        {{ $p.Name }} {{ if $p.Array }}[]{{ end }}{{ if $p.Pointer }}*{{ end }}{{ if $p.TypePackage }}{{ $p.TypePackage }}.{{ end }}{{ $p.Type }}
+        {{ $p.Name }} {{ $p.Type }}
         {{- if not (last $method.Params $pi) -}}, {{ end -}}
     {{- end }}
 {{- end -}}
@@ -56,132 +103,303 @@ var tmplService = template.Must(
     {{- $multi := gt (len $method.Results) 1 }}
     {{- if $multi }}({{ end }}
     {{- range $pi, $p := $method.Results -}}
-        {{ if $p.Array }}[]{{ end }}{{ if $p.Pointer }}*{{ end }}{{ if $p.TypePackage }}{{ $p.TypePackage }}.{{ end }}{{ $p.Type }}
+        {{ $p.Type }}
         {{- if not (last $method.Results $pi) -}}, {{ end -}}
     {{- end }}
     {{- if $multi }}){{ end }}
 {{- end -}}
 
+{{- define "result_values" }}
+    {{- $method := . }}
+    {{- if $method.ResponseEnvelope }}
+        {{- range $r := $method.Values }}result.{{ $r.FieldName }}, {{ end }}
+    {{- else if $method.HasResult }}result, {{ end }}
+{{- end -}}
+
+{{- define "server_intercept" }}
+    {{- $method := . }}
+    {{- if $method.HasResult }}result{{ else }}_{{ end }}, err = h.opts.Intercept(innerCtx,
+    {{- if $method.RequestEnvelope }} &req,
+    {{- else if $method.EncodesArgs }} req,
+    {{- else if gt (len $method.Params) 1 }} string(msg.Data),
+    {{- else }} nil,
+    {{- end }} info, h.handle{{ $method.Name }})
+{{- end -}}
+
+{{- define "server_args" }}
+    {{- if .RequestEnvelope }}
+        {{- range $p := .Args }}, r.{{ $p.FieldName }}{{ if $p.IsVariadic }}...{{ end }}{{ end }}
+    {{- end }}
+{{- end -}}
+
+{{- define "client_request" }}
+    {{- $srv := .Service }}
+    {{- $method := .Method }}
+    {{- if $method.RequestEnvelope }}&{{ requestType $srv $method }}{
+        {{- range $p := $method.Args }}
+        {{ $p.FieldName }}: {{ $p.Name }},
+        {{- end }}
+    }
+    {{- else if gt (len $method.Params) 1 }}{{ (index $method.Params 1).Name }}
+    {{- else }}nil
+    {{- end }}
+{{- end -}}
+
+{{- define "durable_config" }}
+    {{- $srv := .Service }}
+    {{- $method := .Method -}}
+    autonats.DurableConfig{
+        Service: "{{ $srv.Name }}",
+        Method: "{{ $method.Name }}",
+        Timeout: {{ duration $method.Timeout }},
+        MaxDeliver: {{ $method.MaxDeliver }},
+        {{- if $method.Backoff }}
+        Backoff: []time.Duration{ {{- range $i, $d := $method.Backoff }}{{ if $i }}, {{ end }}{{ duration $d }}{{ end -}} },
+        {{- end }}
+        {{- if $method.DeadLetterSubject }}
+        DeadLetterSubject: "{{ $method.DeadLetterSubject }}",
+        {{- end }}
+    }
+{{- end -}}
+
+{{- define "retry_policy" -}}
+    autonats.RetryPolicy{
+        MaxAttempts: {{ .MaxAttempts }},
+        {{- if .InitialBackoff }}
+        InitialBackoff: {{ duration .InitialBackoff }},
+        {{- end }}
+        {{- if .MaxBackoff }}
+        MaxBackoff: {{ duration .MaxBackoff }},
+        {{- end }}
+        {{- if .RetryableCodes }}
+        RetryableCodes: []autonats.Code{ {{- range $i, $c := .RetryableCodes }}{{ if $i }}, {{ end }}{{ codeExpr $c }}{{ end -}} },
+        {{- end }}
+    }
+{{- end -}}
+
+{{- define "server_span_error" }}
+    {{- if .OpenTracing }}
+        replySpan.LogFields(log.Error(err))
+        ext.Error.Set(replySpan, true)
+    {{- end }}
+{{- end -}}
+
+{{- define "client_span_error" }}
+    {{- if .OpenTracing }}
+        reqSpan.LogFields(log.Error(err))
+        ext.Error.Set(reqSpan, true)
+    {{- end }}
+{{- end -}}
+
 {{- define "server_interface" }}
-    type {{ .Name }}Server interface {
+    {{- $srv := . }}
+    type {{ .ServerName }} interface {
     {{- range $index, $method := .Methods }}
         {{ $method.Name }}({{ template "params" $method }}) {{ template "results" $method }}
     {{- end }}
     }
-{{ end -}}
 
-{{ define "type_ref" -}}
-    {{ if .Array }}[]{{ if .Pointer }}*{{ end }}{{ end }}
-    {{- if .TypePackage }}{{ .TypePackage }}.{{ end }}{{ .Type }}
-{{- end }}
+    {{- range $method := .Methods }}
+    {{- if $method.RequestEnvelope }}
+
+    type {{ requestType $srv $method }} struct {
+    {{- range $p := $method.Args }}
+        {{ $p.FieldName }} {{ $p.Type.Value }} {{ jsonTag $p.Name }}
+    {{- end }}
+    }
+    {{- end }}
+
+    {{- if $method.ResponseEnvelope }}
+
+    type {{ responseType $srv $method }} struct {
+    {{- range $r := $method.Values }}
+        {{ $r.FieldName }} {{ $r.Type }} {{ jsonTag $r.Name }}
+    {{- end }}
+    }
+    {{- end }}
+    {{- end }}
+{{ end -}}
 
-{{ define "type_ref_full" -}}
-	{{ if and (not .Array) .Pointer }}*{{ end }}{{ template "type_ref" . }}
-{{- end }}
+{{ generatedHeader }}
 
 package {{ .PackageName }}
 
 import (
-{{ range .Imports }}	"{{ . }}"
+{{ range .Imports }}	{{ if .Name }}{{ .Name }} {{ end }}"{{ .Path }}"
 {{ end -}}
 )
 
 {{ range $srv := .Services }}
+    {{- if not $srv.Events }}
     {{ template "server_interface" $srv }}
+    {{- end }}
 
-    {{- $handlerName := (printf "%sHandler" (lower $srv.Name)) }}
-    {{- $serverName := (printf "%sServer" $srv.Name) }}
-    {{- $clientName := (printf "%sClient" $srv.Name) }}
+    {{- $handlerName := $srv.HandlerName }}
+    {{- $serverName := $srv.ServerName }}
+    {{- $clientName := $srv.ClientName }}
 
     type {{ $handlerName }} struct {
         Server {{ $serverName }}
         NatsConn *nats.Conn
+        opts *autonats.HandlerOptions
         runners []*autonats.Runner
     }
 
     func (h *{{ $handlerName }}) Run(ctx context.Context) error {
         h.runners = make([]*autonats.Runner, {{ len $srv.Methods }}, {{ len $srv.Methods }})
+		{{- if $.OpenTracing }}
 		tracer := opentracing.GlobalTracer()
+		{{- end }}
 
         {{- range $index, $method := $srv.Methods }}
             {{- $subject := subject $srv $method }}
-            if runner, err := autonats.StartRunner(ctx, h.NatsConn, "{{ $subject }}", "autonats", {{ $method.HandlerConcurrency }}, func(msg *nats.Msg) {
-                t := not.NewTraceMsg(msg)
-				sc, err := tracer.Extract(opentracing.Binary, t)
-				if err != nil {
+            {{- $queued := or $srv.Events $method.Durable }}
+            {{- if $method.Durable }}
+            if runner, err := h.opts.StartDurableRunner(ctx, h.NatsConn, {{ template "durable_config" (args $srv $method) }}, {{ $method.HandlerConcurrency }}, func(msg *nats.Msg) error {
+            {{- else }}
+            if runner, err := h.opts.StartRunner(ctx, h.NatsConn, "{{ $subject }}", {{ if $srv.Events }}h.opts.QueueGroup{{ else }}"autonats"{{ end }}, {{ $method.HandlerConcurrency }}, func(msg *nats.Msg) {
+            {{- end }}
+				info := &autonats.CallInfo{Service: "{{ $srv.Name }}", Method: "{{ $method.Name }}", Subject: msg.Subject}
+
+				// retried calls that were already handled aren't handled again
+				if {{ if $method.Async }}_{{ else }}replyData{{ end }}, ok := h.opts.Replay(ctx, info, msg); ok {
+					{{- if $method.Durable }}
+					return nil
+					{{- else if $method.Async }}
+					return
+					{{- else }}
+					_ = msg.Respond(replyData)
 					return
+					{{- end }}
 				}
-		
-				replySpan := tracer.StartSpan("autonats:{{ $serverName }}:{{ $method.Name }}", ext.SpanKindRPCServer, ext.RPCServerOption(sc))
+
+				{{- if not $method.Async }}
+
+				reply := autonats.GetReply()
+				defer autonats.PutReply(reply)
+				{{- end }}
+
+				var err error
+
+				{{- if $.OpenTracing }}
+				// messages without a valid span context, e.g. sent with a noop tracer, start a new trace
+				sc, _ := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(msg.Header))
+				replySpan := tracer.StartSpan("autonats:{{ $serverName }}:{{ $method.Name }}", {{ if $queued }}ext.SpanKindConsumer, opentracing.FollowsFrom(sc){{ else }}ext.SpanKindRPCServer, ext.RPCServerOption(sc){{ end }})
 				ext.MessageBusDestination.Set(replySpan, msg.Subject)
 				ext.Component.Set(replySpan, "autonats")
 
 				defer replySpan.Finish()
-				innerCtx, _ := context.WithTimeout(ctx, time.Second * {{ $method.Timeout }})
-				innerCtxT := opentracing.ContextWithSpan(innerCtx, replySpan)
+				{{- end }}
 
-				{{ $hasResult := gt (len $method.Results) 1 }}
-				
-				{{ if $hasResult }}
-				var result {{ template "type_ref_full" (index $method.Results 0) }}
-				{{ end }}
+				innerCtx, cancelFn := autonats.ContextWithDeadline(ctx, msg, {{ duration $method.Timeout }})
+				defer cancelFn()
+				innerCtx = autonats.ContextFromMsg(innerCtx, msg)
 
-				{{ $hasParam := gt (len $method.Params) 1 }}
-				{{ if $hasParam }}
-
-				{{ $param := index $method.Params 1 }}
-
-				{{ if eq $param.Type "string" -}}
-				{{ if $hasResult }}result, {{ end }} err = h.Server.{{ $method.Name }}(innerCtxT, string(t.Bytes()))
-				{{ else }}
-                var data {{ template "type_ref" $param }}
-                if err = {{ $.JsonLib }}.Unmarshal(t.Bytes(), &data); err != nil {
-					replySpan.LogFields(log.Error(err))
-					ext.Error.Set(replySpan, true)
-                    return
-                }
-				{{ if $hasResult }}result, {{ end }} err = h.Server.{{ $method.Name }}(innerCtxT, {{ if and $param.Pointer (not $param.Array) }}&{{ end }}data)
-				{{ end }}
+				{{- if $.OTel }}
+				innerCtx, call := autonats.{{ if $queued }}StartConsumerCall{{ else }}StartServerCall{{ end }}(innerCtx, msg, "{{ $srv.Name }}", "{{ $method.Name }}")
+
+				// a panic ends the call with an Internal error before the runner recovers it
+				defer func() {
+					if v := recover(); v != nil {
+						call.End(autonats.Errorf(autonats.Internal, "autonats: panic: %v", v))
+						panic(v)
+					}
 
-				{{ else }}
-				{{ if $hasResult }}result, {{ end }} err = h.Server.{{ $method.Name }}(innerCtxT)
+					call.End(err)
+				}()
+				{{- end }}
+
+				{{- if $.OpenTracing }}
+				innerCtx = opentracing.ContextWithSpan(innerCtx, replySpan)
+				{{- end }}
+
+				{{ if $method.RequestEnvelope }}
+				var req {{ requestType $srv $method }}
+				{{ else if $method.EncodesArgs }}
+				var req {{ (index $method.Params 1).Type.Value }}
 				{{ end }}
-				
-				reply := autonats.GetReply()
-				defer autonats.PutReply(reply)
 
-				{{ $result := index $method.Results 0 }}
-				{{ $nilResult := nilResult $result }}
-	
-				if err != nil {
-					ext.Error.Set(replySpan, true)
-					reply.Error = []byte(err.Error())
-				{{ if $hasResult }}
-				} else if result != {{ $nilResult }} {
-					if err := reply.MarshalAndSetData(result); err != nil {
-						replySpan.LogFields(log.Error(err))
-						ext.Error.Set(replySpan, true)
-						return
+				{{- if $method.HasResult }}
+				var result interface{}
+				{{- end }}
+
+				{{- if $method.EncodesArgs }}
+
+				if err = autonats.DecodeMsg("{{ $srv.Codec }}", msg, &req); err != nil {
+					err = autonats.DecodeError(autonats.InvalidArgument, err)
+				} else {
+					{{ template "server_intercept" $method }}
+				}
+				{{- else }}
+
+				{{ template "server_intercept" $method }}
+				{{- end }}
+
+				{{- if $method.HasResult }}
+
+				if err == nil {
+					{{- if and (not $method.ResponseEnvelope) (index $method.Results 0).IsString }}
+					value, _ := result.(string)
+					reply.WriteString(value)
+					{{- else }}
+					if err = reply.Encode("{{ $srv.Codec }}", result); err != nil {
+						err = autonats.WrapError(autonats.Internal, err)
 					}
-				{{ end }}
+					{{- end }}
+				}
+				{{- end }}
+
+
+				{{- if $method.Durable }}
+				if err == nil {
+					h.opts.Remember(innerCtx, info, msg, nil)
+				}
+				{{- if $.OpenTracing }} else {
+					{{- template "server_span_error" $ }}
 				}
+				{{- end }}
+
+				// failed durable calls are delivered again or dead-lettered by the runner
+				return err
+				{{- else if $method.Async }}
 
-				replyData, err := reply.MarshalBinary()
+				// fire-and-forget calls have no caller waiting for a reply
+				if err != nil {
+					{{- template "server_span_error" $ }}
+					h.opts.HandleError(innerCtx, info, err)
+				} else {
+					h.opts.Remember(innerCtx, info, msg, nil)
+				}
+				{{- else }}
 
 				if err != nil {
-					replySpan.LogFields(log.Error(err))
-					ext.Error.Set(replySpan, true)
+					{{- template "server_span_error" $ }}
+					reply.SetError(err)
+				}
+
+				replyData, marshalErr := reply.MarshalBinary()
+
+				if marshalErr != nil {
+					err = autonats.WrapError(autonats.Internal, marshalErr)
+					{{- template "server_span_error" $ }}
 					return
 				}
-		
+
+				if err == nil {
+					h.opts.Remember(innerCtx, info, msg, replyData)
+				}
+
+				{{ if $.OpenTracing -}}
 				if err := msg.Respond(replyData); err != nil {
-					replySpan.LogFields(log.Error(err))
-					ext.Error.Set(replySpan, true)
-					return
+					{{- template "server_span_error" $ }}
 				}
+				{{- else -}}
+				_ = msg.Respond(replyData)
+				{{- end }}
+				{{- end }}
             }); err != nil {
 				{{- if gt $index 0 }}
-				h.Shutdown()
+				_ = h.Shutdown(ctx)
 				{{ end -}}
                 return err
             } else {
@@ -192,125 +410,235 @@ import (
         return nil
     }
 
-    func (h *{{ $handlerName }}) Shutdown() {
-        for i := range h.runners {
-			if h.runners[i] != nil {
-            	_ = h.runners[i].Shutdown()
-			}
-        }
+    {{- range $method := $srv.Methods }}
+
+    func (h *{{ $handlerName }}) handle{{ $method.Name }}(ctx context.Context, req interface{}) (interface{}, error) {
+        {{- $args := "" }}
+        {{- if $method.RequestEnvelope }}
+        r := req.(*{{ requestType $srv $method }})
+
+        {{- else if gt (len $method.Params) 1 }}
+        {{- $param := index $method.Params 1 }}
+        {{- $args = printf ", req.(%s)%s" $param.Type.Value (or (and $param.IsVariadic "...") "") }}
+        {{- end }}
+
+        {{- if $method.ResponseEnvelope }}
+        var result {{ responseType $srv $method }}
+        var err error
+
+        {{ template "result_values" $method }}err = h.Server.{{ $method.Name }}(ctx{{ template "server_args" $method }}{{ $args }})
+
+        return &result, err
+        {{- else if $method.HasResult }}
+        return h.Server.{{ $method.Name }}(ctx{{ template "server_args" $method }}{{ $args }})
+        {{- else if $method.ReturnsError }}
+        return nil, h.Server.{{ $method.Name }}(ctx{{ template "server_args" $method }}{{ $args }})
+        {{- else }}
+        h.Server.{{ $method.Name }}(ctx{{ template "server_args" $method }}{{ $args }})
+
+        return nil, nil
+        {{- end }}
     }
+    {{- end }}
 
-    func New{{ $srv.Name }}Handler(server {{ $serverName }}, nc *nats.Conn) autonats.Handler {
+    func (h *{{ $handlerName }}) Shutdown(ctx context.Context) error {
+        return autonats.DrainRunners(ctx, h.runners...)
+    }
+
+    func New{{ $srv.Name }}{{ if $srv.Events }}Subscriber{{ else }}Handler{{ end }}(server {{ $serverName }}, nc *nats.Conn, opts ...autonats.HandlerOption) autonats.Handler {
         return &{{ $handlerName }}{
             Server: server,
             NatsConn: nc,
+            opts: autonats.NewHandlerOptions(opts...),
         }
     }
 
-    type {{ $clientName }} struct { NatsConn *nats.Conn }
+    type {{ $clientName }} struct {
+        NatsConn *nats.Conn
+        opts *autonats.ClientOptions
+    }
 
-	func New{{ $clientName }}(nc *nats.Conn) *{{ $clientName }} {
-		return &{{ $clientName }}{ NatsConn: nc }
+	func New{{ $clientName }}(nc *nats.Conn, opts ...autonats.ClientOption) *{{ $clientName }} {
+		return &{{ $clientName }}{
+			NatsConn: nc,
+			{{- if $srv.HasRetries }}
+			opts: autonats.NewClientOptions(append([]autonats.ClientOption{
+				{{- range $method := $srv.Methods }}
+				{{- with $method.Retry }}
+				autonats.WithAnnotatedRetryPolicy("{{ $method.Name }}", {{ template "retry_policy" . }}),
+				{{- end }}
+				{{- end }}
+			}, opts...)...),
+			{{- else }}
+			opts: autonats.NewClientOptions(opts...),
+			{{- end }}
+		}
 	}
 
     {{ range $index, $method := .Methods }}
-        func (client *{{ $clientName }}) {{ $method.Name }}({{ template "params" $method }}) {{ template "results" $method }} {
         {{- $subject := subject $srv $method }}
-        {{- $hasResult := gt (len $method.Results) 1 }}
-	
-		{{ $nilResult := "" }}
-	
-		{{ if $hasResult }}
-			{{ $result := index $method.Results 0 }}
-			{{ $nilResult = combine (nilResult $result)  ", "}}
-		{{ end }}
-		
-		reqSpan, reqCtx := opentracing.StartSpanFromContext(ctx, "autonats:{{ $clientName }}:{{ $method.Name }}", ext.SpanKindRPCClient)
+        func (client *{{ $clientName }}) {{ $method.Name }}({{ template "params" $method }}) {{ template "results" $method }} {
+            {{- if not $method.ReturnsError }}
+            info := &autonats.CallInfo{Service: "{{ $srv.Name }}", Method: "{{ $method.Name }}", Subject: "{{ $subject }}"}
+
+            if _, err := client.opts.Invoke(ctx, {{ template "client_request" (args $srv $method) }}, info, client.invoke{{ $method.Name }}); err != nil {
+                client.opts.HandleError(ctx, info, err)
+            }
+            {{- else }}
+            {{ if $method.HasResult }}resp{{ else }}_{{ end }}, err := client.opts.Invoke(ctx, {{ template "client_request" (args $srv $method) }}, &autonats.CallInfo{Service: "{{ $srv.Name }}", Method: "{{ $method.Name }}", Subject: "{{ $subject }}"}, client.invoke{{ $method.Name }})
+            {{- end }}
+
+            {{- if $method.ResponseEnvelope }}
+
+            result, _ := resp.(*{{ responseType $srv $method }})
+
+            if result == nil {
+                result = &{{ responseType $srv $method }}{}
+            }
+
+            return {{ template "result_values" $method }}err
+            {{- else if $method.HasResult }}
+
+            result, _ := resp.({{ (index $method.Results 0).Type }})
+
+            return result, err
+            {{- else if $method.ReturnsError }}
+
+            return err
+            {{- end }}
+        }
+
+        func (client *{{ $clientName }}) invoke{{ $method.Name }}(ctx context.Context, req interface{}) (interface{}, error) {
+		var err error
+
+		{{- if and $method.Async (not $method.Durable) }}
+
+		reqCtx := ctx
+		{{- else }}
+
+		reqCtx, cancelFn := context.WithTimeout(ctx, {{ duration $method.Timeout }})
+		defer cancelFn()
+		{{- end }}
+
+		{{- if $.OpenTracing }}
+
+		reqSpan, reqCtx := opentracing.StartSpanFromContext(reqCtx, "autonats:{{ $clientName }}:{{ $method.Name }}", {{ if or $srv.Events $method.Durable }}ext.SpanKindProducer{{ else }}ext.SpanKindRPCClient{{ end }})
 		ext.MessageBusDestination.Set(reqSpan, "{{ $subject }}")
 		ext.Component.Set(reqSpan, "autonats")
 		defer reqSpan.Finish()
-	
-		var t not.TraceMsg
-		var err error
-	
-		if err = opentracing.GlobalTracer().Inject(reqSpan.Context(), opentracing.Binary, &t); err != nil {
-			reqSpan.LogFields(log.Error(err))
-			ext.Error.Set(reqSpan, true)
-			return {{ $nilResult }} err
+		{{- end }}
+
+		{{- if $method.Async }}
+
+		// fire-and-forget calls aren't bound to the deadline of the caller
+		reqMsg := autonats.NewRequestMsg(context.WithoutCancel(reqCtx), client.NatsConn, "{{ $subject }}", "{{ if $method.EncodesArgs }}{{ $srv.Codec }}{{ end }}")
+		{{- else }}
+
+		reqMsg := autonats.NewRequestMsg(reqCtx, client.NatsConn, "{{ $subject }}", "{{ if $method.EncodesArgs }}{{ $srv.Codec }}{{ end }}")
+		{{- end }}
+
+		{{- if $.OpenTracing }}
+
+		if err = reqSpan.Tracer().Inject(reqSpan.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(reqMsg.Header)); err != nil {
+			err = autonats.WrapError(autonats.Internal, err)
+			{{- template "client_span_error" $ }}
+			return nil, err
 		}
+		{{- end }}
 
+		{{- if $.OTel }}
 
-		{{ $hasParam := gt (len $method.Params) 1 }}
-		{{ if $hasParam }}
-			{{ $param := index $method.Params 1 }}
-			{{ $isString := eq $param.Type "string" }}
-			
-			{{ if not $isString }}
-				var data []byte
-				data, err = jsoniter.Marshal({{ $param.Name }})
-				if err != nil {
-					reqSpan.LogFields(log.Error(err))
-					ext.Error.Set(reqSpan, true)
-					return {{ $nilResult }} err
-				}
-			{{ end }}
-			if _, err = t.Write(
-			{{- if eq $param.Type "string" -}}
-				[]byte({{ $param.Name }})
-			{{- else -}}
-				data
-			{{- end -}}
-			); err != nil {
-				reqSpan.LogFields(log.Error(err))
-				ext.Error.Set(reqSpan, true)
-				return {{ $nilResult }} err
-			}
-		{{ end }}	
-
-		reqCtx, cancelFn := context.WithTimeout(reqCtx, time.Second * {{ $method.Timeout }})
-		defer cancelFn()
-		var replyMsg *nats.Msg
-		if replyMsg, err = client.NatsConn.RequestWithContext(reqCtx, "{{ $subject }}", t.Bytes()); err != nil {
-			reqSpan.LogFields(log.Error(err))
-			ext.Error.Set(reqSpan, true)
-			return {{ $nilResult }} err
+		{{ if $method.Async }}_{{ else }}reqCtx{{ end }}, call := autonats.{{ if or $srv.Events $method.Durable }}StartProducerCall{{ else }}StartClientCall{{ end }}(reqCtx, reqMsg, "{{ $srv.Name }}", "{{ $method.Name }}")
+		defer func() { call.End(err) }()
+		{{- end }}
+
+		{{- if $method.EncodesArgs }}
+
+		if reqMsg.Data, err = autonats.Encode("{{ $srv.Codec }}", req); err != nil {
+			err = autonats.WrapError(autonats.Internal, err)
+			{{- template "client_span_error" $ }}
+			return nil, err
+		}
+		{{- else if gt (len $method.Params) 1 }}
+
+		reqMsg.Data = []byte(req.(string))
+		{{- end }}
+
+		{{- if $method.Durable }}
+
+		// returns once the call is stored in the stream
+		if err = client.opts.PublishDurable(reqCtx, client.NatsConn, "{{ $srv.Name }}", reqMsg); err != nil {
+			err = autonats.TransportError(err)
+			{{- template "client_span_error" $ }}
+			return nil, err
+		}
+
+		return nil, nil
+		{{- else if $method.Async }}
+
+		if err = client.NatsConn.PublishMsg(reqMsg); err != nil {
+			err = autonats.TransportError(err)
+			{{- template "client_span_error" $ }}
+			return nil, err
+		}
+
+		return nil, nil
+		{{- else }}
+
+		replyMsg, err := client.NatsConn.RequestMsgWithContext(reqCtx, reqMsg)
+
+		if err != nil {
+			err = autonats.TransportError(err)
+			{{- template "client_span_error" $ }}
+			return nil, err
 		}
 
 		reply := autonats.GetReply()
 		defer autonats.PutReply(reply)
 		
-		if err := reply.UnmarshalBinary(replyMsg.Data); err != nil {
-			reqSpan.LogFields(log.Error(err))
-			ext.Error.Set(reqSpan, true)
-			return {{ $nilResult }} err
+		if err = reply.UnmarshalBinary(replyMsg.Data); err != nil {
+			err = autonats.WrapError(autonats.Internal, err)
+			{{- template "client_span_error" $ }}
+			return nil, err
 		}
 
-		if err := reply.GetError(); err != nil {
-			reqSpan.LogFields(log.Error(err))
-			ext.Error.Set(reqSpan, true)
-			return {{ $nilResult }} err
+		if err = reply.GetError(); err != nil {
+			{{- template "client_span_error" $ }}
+			return nil, err
 		}
 
-		{{ if $hasResult }}
-			{{ $result := (index $method.Results 0) }}
-			
-			{{ if eq $result.Type "string" }}
-				return reply.GetDataAsString()
-			{{ else }}
-
-			var result {{ template "type_ref" $result }}
-			if err := reply.UnmarshalData(&result); err != nil {
-				reqSpan.LogFields(log.Error(err))
-				ext.Error.Set(reqSpan, true)
-				return {{ $nilResult }} err
-			}
-	
-			return {{ if and $result.Pointer (not $result.Array) }}&{{ end }}result, nil
-			{{ end }}	
-
-		{{ else }}
-            return nil
-        {{- end }}
+		{{- if $method.ResponseEnvelope }}
+
+		var result {{ responseType $srv $method }}
+
+		if err = reply.Decode("{{ $srv.Codec }}", &result); err != nil {
+			err = autonats.DecodeError(autonats.Internal, err)
+			{{- template "client_span_error" $ }}
+			return nil, err
+		}
+
+		return &result, nil
+		{{- else if $method.HasResult }}
+		{{- if (index $method.Results 0).IsString }}
+
+		return reply.GetDataAsString(), nil
+		{{- else }}
+
+		var result {{ (index $method.Results 0).Type }}
+
+		if err = reply.Decode("{{ $srv.Codec }}", &result); err != nil {
+			err = autonats.DecodeError(autonats.Internal, err)
+			{{- template "client_span_error" $ }}
+			return nil, err
+		}
+
+		return result, nil
+		{{- end }}
+		{{- else }}
+
+		return nil, nil
+		{{- end }}
+		{{- end }}
         }
     {{ end }}
 
@@ -0,0 +1,22 @@
+package diagnostics
+
+import "context"
+
+// @nats:server
+type Unnamed interface {
+	Get(ctx context.Context) error
+}
+
+// @nats:server Bad
+// @nats:retries 3
+type Bad interface {
+	// @nats:timeout soon
+	Get(ctx context.Context, id string) error
+
+	NoContext(id string) error
+
+	NoError(ctx context.Context) string
+}
+
+// @nats:server NotInterface
+type NotInterface struct{}
@@ -0,0 +1,48 @@
+package fixture
+
+import (
+	"context"
+	"github.com/zyra/autonats/testdata/fixture/sub"
+)
+
+type Item struct {
+	ID   string   `json:"id"`
+	Tags []string `json:"tags"`
+}
+
+// Embedded into Store, its methods are generated as if they were declared there
+type Reader interface {
+	Get(ctx context.Context, id string) (*Item, error)
+}
+
+// Service used by the generator and runtime tests
+// @nats:server Store
+// @nats:timeout 2s
+type Store interface {
+	Reader
+
+	// Several args and results are sent in envelopes
+	Put(ctx context.Context, id string, item *Item) (version int, created bool, err error)
+
+	Tag(ctx context.Context, id string, tags ...string) ([]string, error)
+
+	// Envelope fields get unique exported names
+	Rename(ctx context.Context, id string, Id int, _name string) (_old string, Old int, err error)
+
+	// The param shadows the package of its type
+	Label(ctx context.Context, sub *sub.Label) (*sub.Label, error)
+
+	// Runs an action chosen by the test, see fixture_test.go
+	Do(ctx context.Context, action string) (string, error)
+
+	// @nats:async
+	Touch(ctx context.Context, id string) error
+}
+
+// @nats:events StoreEvents
+type StoreEvents interface {
+	Updated(ctx context.Context, item *Item)
+
+	// Errors are passed to the error handler of the subscriber
+	Deleted(ctx context.Context, id string) error
+}
@@ -0,0 +1,1098 @@
+// Code generated by autonats. DO NOT EDIT.
+
+package fixture
+
+import (
+	"context"
+	"github.com/nats-io/nats.go"
+	"github.com/zyra/autonats"
+	"github.com/zyra/autonats/testdata/fixture/sub"
+	"time"
+)
+
+type StoreServer interface {
+	Get(ctx context.Context, id string) (*Item, error)
+	Put(ctx context.Context, id string, item *Item) (int, bool, error)
+	Tag(ctx context.Context, id string, tags ...string) ([]string, error)
+	Rename(ctx context.Context, id string, Id int, _name string) (string, int, error)
+	Label(ctx context.Context, sub1 *sub.Label) (*sub.Label, error)
+	Do(ctx context.Context, action string) (string, error)
+	Touch(ctx context.Context, id string) error
+}
+
+type storePutRequest struct {
+	Id   string `json:"id"`
+	Item *Item  `json:"item"`
+}
+
+type storePutResponse struct {
+	Version int  `json:"version"`
+	Created bool `json:"created"`
+}
+
+type storeTagRequest struct {
+	Id   string   `json:"id"`
+	Tags []string `json:"tags"`
+}
+
+type storeRenameRequest struct {
+	Id   string `json:"id"`
+	Id1  int    `json:"Id"`
+	Name string `json:"_name"`
+}
+
+type storeRenameResponse struct {
+	Old  string `json:"_old"`
+	Old1 int    `json:"Old"`
+}
+
+type storeHandler struct {
+	Server   StoreServer
+	NatsConn *nats.Conn
+	opts     *autonats.HandlerOptions
+	runners  []*autonats.Runner
+}
+
+func (h *storeHandler) Run(ctx context.Context) error {
+	h.runners = make([]*autonats.Runner, 7, 7)
+	if runner, err := h.opts.StartRunner(ctx, h.NatsConn, "autonats.Store.Get", "autonats", 5, func(msg *nats.Msg) {
+		info := &autonats.CallInfo{Service: "Store", Method: "Get", Subject: msg.Subject}
+
+		// retried calls that were already handled aren't handled again
+		if replyData, ok := h.opts.Replay(ctx, info, msg); ok {
+			_ = msg.Respond(replyData)
+			return
+		}
+
+		reply := autonats.GetReply()
+		defer autonats.PutReply(reply)
+
+		var err error
+
+		innerCtx, cancelFn := autonats.ContextWithDeadline(ctx, msg, 2*time.Second)
+		defer cancelFn()
+		innerCtx = autonats.ContextFromMsg(innerCtx, msg)
+		innerCtx, call := autonats.StartServerCall(innerCtx, msg, "Store", "Get")
+
+		// a panic ends the call with an Internal error before the runner recovers it
+		defer func() {
+			if v := recover(); v != nil {
+				call.End(autonats.Errorf(autonats.Internal, "autonats: panic: %v", v))
+				panic(v)
+			}
+
+			call.End(err)
+		}()
+
+		var result interface{}
+
+		result, err = h.opts.Intercept(innerCtx, string(msg.Data), info, h.handleGet)
+
+		if err == nil {
+			if err = reply.Encode("jsoniter", result); err != nil {
+				err = autonats.WrapError(autonats.Internal, err)
+			}
+		}
+
+		if err != nil {
+			reply.SetError(err)
+		}
+
+		replyData, marshalErr := reply.MarshalBinary()
+
+		if marshalErr != nil {
+			err = autonats.WrapError(autonats.Internal, marshalErr)
+			return
+		}
+
+		if err == nil {
+			h.opts.Remember(innerCtx, info, msg, replyData)
+		}
+
+		_ = msg.Respond(replyData)
+	}); err != nil {
+		return err
+	} else {
+		h.runners[0] = runner
+	}
+
+	if runner, err := h.opts.StartRunner(ctx, h.NatsConn, "autonats.Store.Put", "autonats", 5, func(msg *nats.Msg) {
+		info := &autonats.CallInfo{Service: "Store", Method: "Put", Subject: msg.Subject}
+
+		// retried calls that were already handled aren't handled again
+		if replyData, ok := h.opts.Replay(ctx, info, msg); ok {
+			_ = msg.Respond(replyData)
+			return
+		}
+
+		reply := autonats.GetReply()
+		defer autonats.PutReply(reply)
+
+		var err error
+
+		innerCtx, cancelFn := autonats.ContextWithDeadline(ctx, msg, 2*time.Second)
+		defer cancelFn()
+		innerCtx = autonats.ContextFromMsg(innerCtx, msg)
+		innerCtx, call := autonats.StartServerCall(innerCtx, msg, "Store", "Put")
+
+		// a panic ends the call with an Internal error before the runner recovers it
+		defer func() {
+			if v := recover(); v != nil {
+				call.End(autonats.Errorf(autonats.Internal, "autonats: panic: %v", v))
+				panic(v)
+			}
+
+			call.End(err)
+		}()
+
+		var req storePutRequest
+
+		var result interface{}
+
+		if err = autonats.DecodeMsg("jsoniter", msg, &req); err != nil {
+			err = autonats.DecodeError(autonats.InvalidArgument, err)
+		} else {
+			result, err = h.opts.Intercept(innerCtx, &req, info, h.handlePut)
+		}
+
+		if err == nil {
+			if err = reply.Encode("jsoniter", result); err != nil {
+				err = autonats.WrapError(autonats.Internal, err)
+			}
+		}
+
+		if err != nil {
+			reply.SetError(err)
+		}
+
+		replyData, marshalErr := reply.MarshalBinary()
+
+		if marshalErr != nil {
+			err = autonats.WrapError(autonats.Internal, marshalErr)
+			return
+		}
+
+		if err == nil {
+			h.opts.Remember(innerCtx, info, msg, replyData)
+		}
+
+		_ = msg.Respond(replyData)
+	}); err != nil {
+		_ = h.Shutdown(ctx)
+		return err
+	} else {
+		h.runners[1] = runner
+	}
+
+	if runner, err := h.opts.StartRunner(ctx, h.NatsConn, "autonats.Store.Tag", "autonats", 5, func(msg *nats.Msg) {
+		info := &autonats.CallInfo{Service: "Store", Method: "Tag", Subject: msg.Subject}
+
+		// retried calls that were already handled aren't handled again
+		if replyData, ok := h.opts.Replay(ctx, info, msg); ok {
+			_ = msg.Respond(replyData)
+			return
+		}
+
+		reply := autonats.GetReply()
+		defer autonats.PutReply(reply)
+
+		var err error
+
+		innerCtx, cancelFn := autonats.ContextWithDeadline(ctx, msg, 2*time.Second)
+		defer cancelFn()
+		innerCtx = autonats.ContextFromMsg(innerCtx, msg)
+		innerCtx, call := autonats.StartServerCall(innerCtx, msg, "Store", "Tag")
+
+		// a panic ends the call with an Internal error before the runner recovers it
+		defer func() {
+			if v := recover(); v != nil {
+				call.End(autonats.Errorf(autonats.Internal, "autonats: panic: %v", v))
+				panic(v)
+			}
+
+			call.End(err)
+		}()
+
+		var req storeTagRequest
+
+		var result interface{}
+
+		if err = autonats.DecodeMsg("jsoniter", msg, &req); err != nil {
+			err = autonats.DecodeError(autonats.InvalidArgument, err)
+		} else {
+			result, err = h.opts.Intercept(innerCtx, &req, info, h.handleTag)
+		}
+
+		if err == nil {
+			if err = reply.Encode("jsoniter", result); err != nil {
+				err = autonats.WrapError(autonats.Internal, err)
+			}
+		}
+
+		if err != nil {
+			reply.SetError(err)
+		}
+
+		replyData, marshalErr := reply.MarshalBinary()
+
+		if marshalErr != nil {
+			err = autonats.WrapError(autonats.Internal, marshalErr)
+			return
+		}
+
+		if err == nil {
+			h.opts.Remember(innerCtx, info, msg, replyData)
+		}
+
+		_ = msg.Respond(replyData)
+	}); err != nil {
+		_ = h.Shutdown(ctx)
+		return err
+	} else {
+		h.runners[2] = runner
+	}
+
+	if runner, err := h.opts.StartRunner(ctx, h.NatsConn, "autonats.Store.Rename", "autonats", 5, func(msg *nats.Msg) {
+		info := &autonats.CallInfo{Service: "Store", Method: "Rename", Subject: msg.Subject}
+
+		// retried calls that were already handled aren't handled again
+		if replyData, ok := h.opts.Replay(ctx, info, msg); ok {
+			_ = msg.Respond(replyData)
+			return
+		}
+
+		reply := autonats.GetReply()
+		defer autonats.PutReply(reply)
+
+		var err error
+
+		innerCtx, cancelFn := autonats.ContextWithDeadline(ctx, msg, 2*time.Second)
+		defer cancelFn()
+		innerCtx = autonats.ContextFromMsg(innerCtx, msg)
+		innerCtx, call := autonats.StartServerCall(innerCtx, msg, "Store", "Rename")
+
+		// a panic ends the call with an Internal error before the runner recovers it
+		defer func() {
+			if v := recover(); v != nil {
+				call.End(autonats.Errorf(autonats.Internal, "autonats: panic: %v", v))
+				panic(v)
+			}
+
+			call.End(err)
+		}()
+
+		var req storeRenameRequest
+
+		var result interface{}
+
+		if err = autonats.DecodeMsg("jsoniter", msg, &req); err != nil {
+			err = autonats.DecodeError(autonats.InvalidArgument, err)
+		} else {
+			result, err = h.opts.Intercept(innerCtx, &req, info, h.handleRename)
+		}
+
+		if err == nil {
+			if err = reply.Encode("jsoniter", result); err != nil {
+				err = autonats.WrapError(autonats.Internal, err)
+			}
+		}
+
+		if err != nil {
+			reply.SetError(err)
+		}
+
+		replyData, marshalErr := reply.MarshalBinary()
+
+		if marshalErr != nil {
+			err = autonats.WrapError(autonats.Internal, marshalErr)
+			return
+		}
+
+		if err == nil {
+			h.opts.Remember(innerCtx, info, msg, replyData)
+		}
+
+		_ = msg.Respond(replyData)
+	}); err != nil {
+		_ = h.Shutdown(ctx)
+		return err
+	} else {
+		h.runners[3] = runner
+	}
+
+	if runner, err := h.opts.StartRunner(ctx, h.NatsConn, "autonats.Store.Label", "autonats", 5, func(msg *nats.Msg) {
+		info := &autonats.CallInfo{Service: "Store", Method: "Label", Subject: msg.Subject}
+
+		// retried calls that were already handled aren't handled again
+		if replyData, ok := h.opts.Replay(ctx, info, msg); ok {
+			_ = msg.Respond(replyData)
+			return
+		}
+
+		reply := autonats.GetReply()
+		defer autonats.PutReply(reply)
+
+		var err error
+
+		innerCtx, cancelFn := autonats.ContextWithDeadline(ctx, msg, 2*time.Second)
+		defer cancelFn()
+		innerCtx = autonats.ContextFromMsg(innerCtx, msg)
+		innerCtx, call := autonats.StartServerCall(innerCtx, msg, "Store", "Label")
+
+		// a panic ends the call with an Internal error before the runner recovers it
+		defer func() {
+			if v := recover(); v != nil {
+				call.End(autonats.Errorf(autonats.Internal, "autonats: panic: %v", v))
+				panic(v)
+			}
+
+			call.End(err)
+		}()
+
+		var req *sub.Label
+
+		var result interface{}
+
+		if err = autonats.DecodeMsg("jsoniter", msg, &req); err != nil {
+			err = autonats.DecodeError(autonats.InvalidArgument, err)
+		} else {
+			result, err = h.opts.Intercept(innerCtx, req, info, h.handleLabel)
+		}
+
+		if err == nil {
+			if err = reply.Encode("jsoniter", result); err != nil {
+				err = autonats.WrapError(autonats.Internal, err)
+			}
+		}
+
+		if err != nil {
+			reply.SetError(err)
+		}
+
+		replyData, marshalErr := reply.MarshalBinary()
+
+		if marshalErr != nil {
+			err = autonats.WrapError(autonats.Internal, marshalErr)
+			return
+		}
+
+		if err == nil {
+			h.opts.Remember(innerCtx, info, msg, replyData)
+		}
+
+		_ = msg.Respond(replyData)
+	}); err != nil {
+		_ = h.Shutdown(ctx)
+		return err
+	} else {
+		h.runners[4] = runner
+	}
+
+	if runner, err := h.opts.StartRunner(ctx, h.NatsConn, "autonats.Store.Do", "autonats", 5, func(msg *nats.Msg) {
+		info := &autonats.CallInfo{Service: "Store", Method: "Do", Subject: msg.Subject}
+
+		// retried calls that were already handled aren't handled again
+		if replyData, ok := h.opts.Replay(ctx, info, msg); ok {
+			_ = msg.Respond(replyData)
+			return
+		}
+
+		reply := autonats.GetReply()
+		defer autonats.PutReply(reply)
+
+		var err error
+
+		innerCtx, cancelFn := autonats.ContextWithDeadline(ctx, msg, 2*time.Second)
+		defer cancelFn()
+		innerCtx = autonats.ContextFromMsg(innerCtx, msg)
+		innerCtx, call := autonats.StartServerCall(innerCtx, msg, "Store", "Do")
+
+		// a panic ends the call with an Internal error before the runner recovers it
+		defer func() {
+			if v := recover(); v != nil {
+				call.End(autonats.Errorf(autonats.Internal, "autonats: panic: %v", v))
+				panic(v)
+			}
+
+			call.End(err)
+		}()
+
+		var result interface{}
+
+		result, err = h.opts.Intercept(innerCtx, string(msg.Data), info, h.handleDo)
+
+		if err == nil {
+			value, _ := result.(string)
+			reply.WriteString(value)
+		}
+
+		if err != nil {
+			reply.SetError(err)
+		}
+
+		replyData, marshalErr := reply.MarshalBinary()
+
+		if marshalErr != nil {
+			err = autonats.WrapError(autonats.Internal, marshalErr)
+			return
+		}
+
+		if err == nil {
+			h.opts.Remember(innerCtx, info, msg, replyData)
+		}
+
+		_ = msg.Respond(replyData)
+	}); err != nil {
+		_ = h.Shutdown(ctx)
+		return err
+	} else {
+		h.runners[5] = runner
+	}
+
+	if runner, err := h.opts.StartRunner(ctx, h.NatsConn, "autonats.Store.Touch", "autonats", 5, func(msg *nats.Msg) {
+		info := &autonats.CallInfo{Service: "Store", Method: "Touch", Subject: msg.Subject}
+
+		// retried calls that were already handled aren't handled again
+		if _, ok := h.opts.Replay(ctx, info, msg); ok {
+			return
+		}
+
+		var err error
+
+		innerCtx, cancelFn := autonats.ContextWithDeadline(ctx, msg, 2*time.Second)
+		defer cancelFn()
+		innerCtx = autonats.ContextFromMsg(innerCtx, msg)
+		innerCtx, call := autonats.StartServerCall(innerCtx, msg, "Store", "Touch")
+
+		// a panic ends the call with an Internal error before the runner recovers it
+		defer func() {
+			if v := recover(); v != nil {
+				call.End(autonats.Errorf(autonats.Internal, "autonats: panic: %v", v))
+				panic(v)
+			}
+
+			call.End(err)
+		}()
+
+		_, err = h.opts.Intercept(innerCtx, string(msg.Data), info, h.handleTouch)
+
+		// fire-and-forget calls have no caller waiting for a reply
+		if err != nil {
+			h.opts.HandleError(innerCtx, info, err)
+		} else {
+			h.opts.Remember(innerCtx, info, msg, nil)
+		}
+	}); err != nil {
+		_ = h.Shutdown(ctx)
+		return err
+	} else {
+		h.runners[6] = runner
+	}
+
+	return nil
+}
+
+func (h *storeHandler) handleGet(ctx context.Context, req interface{}) (interface{}, error) {
+	return h.Server.Get(ctx, req.(string))
+}
+
+func (h *storeHandler) handlePut(ctx context.Context, req interface{}) (interface{}, error) {
+	r := req.(*storePutRequest)
+	var result storePutResponse
+	var err error
+
+	result.Version, result.Created, err = h.Server.Put(ctx, r.Id, r.Item)
+
+	return &result, err
+}
+
+func (h *storeHandler) handleTag(ctx context.Context, req interface{}) (interface{}, error) {
+	r := req.(*storeTagRequest)
+	return h.Server.Tag(ctx, r.Id, r.Tags...)
+}
+
+func (h *storeHandler) handleRename(ctx context.Context, req interface{}) (interface{}, error) {
+	r := req.(*storeRenameRequest)
+	var result storeRenameResponse
+	var err error
+
+	result.Old, result.Old1, err = h.Server.Rename(ctx, r.Id, r.Id1, r.Name)
+
+	return &result, err
+}
+
+func (h *storeHandler) handleLabel(ctx context.Context, req interface{}) (interface{}, error) {
+	return h.Server.Label(ctx, req.(*sub.Label))
+}
+
+func (h *storeHandler) handleDo(ctx context.Context, req interface{}) (interface{}, error) {
+	return h.Server.Do(ctx, req.(string))
+}
+
+func (h *storeHandler) handleTouch(ctx context.Context, req interface{}) (interface{}, error) {
+	return nil, h.Server.Touch(ctx, req.(string))
+}
+
+func (h *storeHandler) Shutdown(ctx context.Context) error {
+	return autonats.DrainRunners(ctx, h.runners...)
+}
+
+func NewStoreHandler(server StoreServer, nc *nats.Conn, opts ...autonats.HandlerOption) autonats.Handler {
+	return &storeHandler{
+		Server:   server,
+		NatsConn: nc,
+		opts:     autonats.NewHandlerOptions(opts...),
+	}
+}
+
+type StoreClient struct {
+	NatsConn *nats.Conn
+	opts     *autonats.ClientOptions
+}
+
+func NewStoreClient(nc *nats.Conn, opts ...autonats.ClientOption) *StoreClient {
+	return &StoreClient{
+		NatsConn: nc,
+		opts:     autonats.NewClientOptions(opts...),
+	}
+}
+
+func (client *StoreClient) Get(ctx context.Context, id string) (*Item, error) {
+	resp, err := client.opts.Invoke(ctx, id, &autonats.CallInfo{Service: "Store", Method: "Get", Subject: "autonats.Store.Get"}, client.invokeGet)
+
+	result, _ := resp.(*Item)
+
+	return result, err
+}
+
+func (client *StoreClient) invokeGet(ctx context.Context, req interface{}) (interface{}, error) {
+	var err error
+
+	reqCtx, cancelFn := context.WithTimeout(ctx, 2*time.Second)
+	defer cancelFn()
+
+	reqMsg := autonats.NewRequestMsg(reqCtx, client.NatsConn, "autonats.Store.Get", "")
+
+	reqCtx, call := autonats.StartClientCall(reqCtx, reqMsg, "Store", "Get")
+	defer func() { call.End(err) }()
+
+	reqMsg.Data = []byte(req.(string))
+
+	replyMsg, err := client.NatsConn.RequestMsgWithContext(reqCtx, reqMsg)
+
+	if err != nil {
+		err = autonats.TransportError(err)
+		return nil, err
+	}
+
+	reply := autonats.GetReply()
+	defer autonats.PutReply(reply)
+
+	if err = reply.UnmarshalBinary(replyMsg.Data); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		return nil, err
+	}
+
+	if err = reply.GetError(); err != nil {
+		return nil, err
+	}
+
+	var result *Item
+
+	if err = reply.Decode("jsoniter", &result); err != nil {
+		err = autonats.DecodeError(autonats.Internal, err)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (client *StoreClient) Put(ctx context.Context, id string, item *Item) (int, bool, error) {
+	resp, err := client.opts.Invoke(ctx, &storePutRequest{
+		Id:   id,
+		Item: item,
+	}, &autonats.CallInfo{Service: "Store", Method: "Put", Subject: "autonats.Store.Put"}, client.invokePut)
+
+	result, _ := resp.(*storePutResponse)
+
+	if result == nil {
+		result = &storePutResponse{}
+	}
+
+	return result.Version, result.Created, err
+}
+
+func (client *StoreClient) invokePut(ctx context.Context, req interface{}) (interface{}, error) {
+	var err error
+
+	reqCtx, cancelFn := context.WithTimeout(ctx, 2*time.Second)
+	defer cancelFn()
+
+	reqMsg := autonats.NewRequestMsg(reqCtx, client.NatsConn, "autonats.Store.Put", "jsoniter")
+
+	reqCtx, call := autonats.StartClientCall(reqCtx, reqMsg, "Store", "Put")
+	defer func() { call.End(err) }()
+
+	if reqMsg.Data, err = autonats.Encode("jsoniter", req); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		return nil, err
+	}
+
+	replyMsg, err := client.NatsConn.RequestMsgWithContext(reqCtx, reqMsg)
+
+	if err != nil {
+		err = autonats.TransportError(err)
+		return nil, err
+	}
+
+	reply := autonats.GetReply()
+	defer autonats.PutReply(reply)
+
+	if err = reply.UnmarshalBinary(replyMsg.Data); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		return nil, err
+	}
+
+	if err = reply.GetError(); err != nil {
+		return nil, err
+	}
+
+	var result storePutResponse
+
+	if err = reply.Decode("jsoniter", &result); err != nil {
+		err = autonats.DecodeError(autonats.Internal, err)
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (client *StoreClient) Tag(ctx context.Context, id string, tags ...string) ([]string, error) {
+	resp, err := client.opts.Invoke(ctx, &storeTagRequest{
+		Id:   id,
+		Tags: tags,
+	}, &autonats.CallInfo{Service: "Store", Method: "Tag", Subject: "autonats.Store.Tag"}, client.invokeTag)
+
+	result, _ := resp.([]string)
+
+	return result, err
+}
+
+func (client *StoreClient) invokeTag(ctx context.Context, req interface{}) (interface{}, error) {
+	var err error
+
+	reqCtx, cancelFn := context.WithTimeout(ctx, 2*time.Second)
+	defer cancelFn()
+
+	reqMsg := autonats.NewRequestMsg(reqCtx, client.NatsConn, "autonats.Store.Tag", "jsoniter")
+
+	reqCtx, call := autonats.StartClientCall(reqCtx, reqMsg, "Store", "Tag")
+	defer func() { call.End(err) }()
+
+	if reqMsg.Data, err = autonats.Encode("jsoniter", req); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		return nil, err
+	}
+
+	replyMsg, err := client.NatsConn.RequestMsgWithContext(reqCtx, reqMsg)
+
+	if err != nil {
+		err = autonats.TransportError(err)
+		return nil, err
+	}
+
+	reply := autonats.GetReply()
+	defer autonats.PutReply(reply)
+
+	if err = reply.UnmarshalBinary(replyMsg.Data); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		return nil, err
+	}
+
+	if err = reply.GetError(); err != nil {
+		return nil, err
+	}
+
+	var result []string
+
+	if err = reply.Decode("jsoniter", &result); err != nil {
+		err = autonats.DecodeError(autonats.Internal, err)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (client *StoreClient) Rename(ctx context.Context, id string, Id int, _name string) (string, int, error) {
+	resp, err := client.opts.Invoke(ctx, &storeRenameRequest{
+		Id:   id,
+		Id1:  Id,
+		Name: _name,
+	}, &autonats.CallInfo{Service: "Store", Method: "Rename", Subject: "autonats.Store.Rename"}, client.invokeRename)
+
+	result, _ := resp.(*storeRenameResponse)
+
+	if result == nil {
+		result = &storeRenameResponse{}
+	}
+
+	return result.Old, result.Old1, err
+}
+
+func (client *StoreClient) invokeRename(ctx context.Context, req interface{}) (interface{}, error) {
+	var err error
+
+	reqCtx, cancelFn := context.WithTimeout(ctx, 2*time.Second)
+	defer cancelFn()
+
+	reqMsg := autonats.NewRequestMsg(reqCtx, client.NatsConn, "autonats.Store.Rename", "jsoniter")
+
+	reqCtx, call := autonats.StartClientCall(reqCtx, reqMsg, "Store", "Rename")
+	defer func() { call.End(err) }()
+
+	if reqMsg.Data, err = autonats.Encode("jsoniter", req); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		return nil, err
+	}
+
+	replyMsg, err := client.NatsConn.RequestMsgWithContext(reqCtx, reqMsg)
+
+	if err != nil {
+		err = autonats.TransportError(err)
+		return nil, err
+	}
+
+	reply := autonats.GetReply()
+	defer autonats.PutReply(reply)
+
+	if err = reply.UnmarshalBinary(replyMsg.Data); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		return nil, err
+	}
+
+	if err = reply.GetError(); err != nil {
+		return nil, err
+	}
+
+	var result storeRenameResponse
+
+	if err = reply.Decode("jsoniter", &result); err != nil {
+		err = autonats.DecodeError(autonats.Internal, err)
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (client *StoreClient) Label(ctx context.Context, sub1 *sub.Label) (*sub.Label, error) {
+	resp, err := client.opts.Invoke(ctx, sub1, &autonats.CallInfo{Service: "Store", Method: "Label", Subject: "autonats.Store.Label"}, client.invokeLabel)
+
+	result, _ := resp.(*sub.Label)
+
+	return result, err
+}
+
+func (client *StoreClient) invokeLabel(ctx context.Context, req interface{}) (interface{}, error) {
+	var err error
+
+	reqCtx, cancelFn := context.WithTimeout(ctx, 2*time.Second)
+	defer cancelFn()
+
+	reqMsg := autonats.NewRequestMsg(reqCtx, client.NatsConn, "autonats.Store.Label", "jsoniter")
+
+	reqCtx, call := autonats.StartClientCall(reqCtx, reqMsg, "Store", "Label")
+	defer func() { call.End(err) }()
+
+	if reqMsg.Data, err = autonats.Encode("jsoniter", req); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		return nil, err
+	}
+
+	replyMsg, err := client.NatsConn.RequestMsgWithContext(reqCtx, reqMsg)
+
+	if err != nil {
+		err = autonats.TransportError(err)
+		return nil, err
+	}
+
+	reply := autonats.GetReply()
+	defer autonats.PutReply(reply)
+
+	if err = reply.UnmarshalBinary(replyMsg.Data); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		return nil, err
+	}
+
+	if err = reply.GetError(); err != nil {
+		return nil, err
+	}
+
+	var result *sub.Label
+
+	if err = reply.Decode("jsoniter", &result); err != nil {
+		err = autonats.DecodeError(autonats.Internal, err)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (client *StoreClient) Do(ctx context.Context, action string) (string, error) {
+	resp, err := client.opts.Invoke(ctx, action, &autonats.CallInfo{Service: "Store", Method: "Do", Subject: "autonats.Store.Do"}, client.invokeDo)
+
+	result, _ := resp.(string)
+
+	return result, err
+}
+
+func (client *StoreClient) invokeDo(ctx context.Context, req interface{}) (interface{}, error) {
+	var err error
+
+	reqCtx, cancelFn := context.WithTimeout(ctx, 2*time.Second)
+	defer cancelFn()
+
+	reqMsg := autonats.NewRequestMsg(reqCtx, client.NatsConn, "autonats.Store.Do", "")
+
+	reqCtx, call := autonats.StartClientCall(reqCtx, reqMsg, "Store", "Do")
+	defer func() { call.End(err) }()
+
+	reqMsg.Data = []byte(req.(string))
+
+	replyMsg, err := client.NatsConn.RequestMsgWithContext(reqCtx, reqMsg)
+
+	if err != nil {
+		err = autonats.TransportError(err)
+		return nil, err
+	}
+
+	reply := autonats.GetReply()
+	defer autonats.PutReply(reply)
+
+	if err = reply.UnmarshalBinary(replyMsg.Data); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		return nil, err
+	}
+
+	if err = reply.GetError(); err != nil {
+		return nil, err
+	}
+
+	return reply.GetDataAsString(), nil
+}
+
+func (client *StoreClient) Touch(ctx context.Context, id string) error {
+	_, err := client.opts.Invoke(ctx, id, &autonats.CallInfo{Service: "Store", Method: "Touch", Subject: "autonats.Store.Touch"}, client.invokeTouch)
+
+	return err
+}
+
+func (client *StoreClient) invokeTouch(ctx context.Context, req interface{}) (interface{}, error) {
+	var err error
+
+	reqCtx := ctx
+
+	// fire-and-forget calls aren't bound to the deadline of the caller
+	reqMsg := autonats.NewRequestMsg(context.WithoutCancel(reqCtx), client.NatsConn, "autonats.Store.Touch", "")
+
+	_, call := autonats.StartClientCall(reqCtx, reqMsg, "Store", "Touch")
+	defer func() { call.End(err) }()
+
+	reqMsg.Data = []byte(req.(string))
+
+	if err = client.NatsConn.PublishMsg(reqMsg); err != nil {
+		err = autonats.TransportError(err)
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+type storeeventsSubscriber struct {
+	Server   StoreEvents
+	NatsConn *nats.Conn
+	opts     *autonats.HandlerOptions
+	runners  []*autonats.Runner
+}
+
+func (h *storeeventsSubscriber) Run(ctx context.Context) error {
+	h.runners = make([]*autonats.Runner, 2, 2)
+	if runner, err := h.opts.StartRunner(ctx, h.NatsConn, "autonats.events.StoreEvents.Updated", h.opts.QueueGroup, 5, func(msg *nats.Msg) {
+		info := &autonats.CallInfo{Service: "StoreEvents", Method: "Updated", Subject: msg.Subject}
+
+		// retried calls that were already handled aren't handled again
+		if _, ok := h.opts.Replay(ctx, info, msg); ok {
+			return
+		}
+
+		var err error
+
+		innerCtx, cancelFn := autonats.ContextWithDeadline(ctx, msg, 5*time.Second)
+		defer cancelFn()
+		innerCtx = autonats.ContextFromMsg(innerCtx, msg)
+		innerCtx, call := autonats.StartConsumerCall(innerCtx, msg, "StoreEvents", "Updated")
+
+		// a panic ends the call with an Internal error before the runner recovers it
+		defer func() {
+			if v := recover(); v != nil {
+				call.End(autonats.Errorf(autonats.Internal, "autonats: panic: %v", v))
+				panic(v)
+			}
+
+			call.End(err)
+		}()
+
+		var req *Item
+
+		if err = autonats.DecodeMsg("jsoniter", msg, &req); err != nil {
+			err = autonats.DecodeError(autonats.InvalidArgument, err)
+		} else {
+			_, err = h.opts.Intercept(innerCtx, req, info, h.handleUpdated)
+		}
+
+		// fire-and-forget calls have no caller waiting for a reply
+		if err != nil {
+			h.opts.HandleError(innerCtx, info, err)
+		} else {
+			h.opts.Remember(innerCtx, info, msg, nil)
+		}
+	}); err != nil {
+		return err
+	} else {
+		h.runners[0] = runner
+	}
+
+	if runner, err := h.opts.StartRunner(ctx, h.NatsConn, "autonats.events.StoreEvents.Deleted", h.opts.QueueGroup, 5, func(msg *nats.Msg) {
+		info := &autonats.CallInfo{Service: "StoreEvents", Method: "Deleted", Subject: msg.Subject}
+
+		// retried calls that were already handled aren't handled again
+		if _, ok := h.opts.Replay(ctx, info, msg); ok {
+			return
+		}
+
+		var err error
+
+		innerCtx, cancelFn := autonats.ContextWithDeadline(ctx, msg, 5*time.Second)
+		defer cancelFn()
+		innerCtx = autonats.ContextFromMsg(innerCtx, msg)
+		innerCtx, call := autonats.StartConsumerCall(innerCtx, msg, "StoreEvents", "Deleted")
+
+		// a panic ends the call with an Internal error before the runner recovers it
+		defer func() {
+			if v := recover(); v != nil {
+				call.End(autonats.Errorf(autonats.Internal, "autonats: panic: %v", v))
+				panic(v)
+			}
+
+			call.End(err)
+		}()
+
+		_, err = h.opts.Intercept(innerCtx, string(msg.Data), info, h.handleDeleted)
+
+		// fire-and-forget calls have no caller waiting for a reply
+		if err != nil {
+			h.opts.HandleError(innerCtx, info, err)
+		} else {
+			h.opts.Remember(innerCtx, info, msg, nil)
+		}
+	}); err != nil {
+		_ = h.Shutdown(ctx)
+		return err
+	} else {
+		h.runners[1] = runner
+	}
+
+	return nil
+}
+
+func (h *storeeventsSubscriber) handleUpdated(ctx context.Context, req interface{}) (interface{}, error) {
+	h.Server.Updated(ctx, req.(*Item))
+
+	return nil, nil
+}
+
+func (h *storeeventsSubscriber) handleDeleted(ctx context.Context, req interface{}) (interface{}, error) {
+	return nil, h.Server.Deleted(ctx, req.(string))
+}
+
+func (h *storeeventsSubscriber) Shutdown(ctx context.Context) error {
+	return autonats.DrainRunners(ctx, h.runners...)
+}
+
+func NewStoreEventsSubscriber(server StoreEvents, nc *nats.Conn, opts ...autonats.HandlerOption) autonats.Handler {
+	return &storeeventsSubscriber{
+		Server:   server,
+		NatsConn: nc,
+		opts:     autonats.NewHandlerOptions(opts...),
+	}
+}
+
+type StoreEventsPublisher struct {
+	NatsConn *nats.Conn
+	opts     *autonats.ClientOptions
+}
+
+func NewStoreEventsPublisher(nc *nats.Conn, opts ...autonats.ClientOption) *StoreEventsPublisher {
+	return &StoreEventsPublisher{
+		NatsConn: nc,
+		opts:     autonats.NewClientOptions(opts...),
+	}
+}
+
+func (client *StoreEventsPublisher) Updated(ctx context.Context, item *Item) {
+	info := &autonats.CallInfo{Service: "StoreEvents", Method: "Updated", Subject: "autonats.events.StoreEvents.Updated"}
+
+	if _, err := client.opts.Invoke(ctx, item, info, client.invokeUpdated); err != nil {
+		client.opts.HandleError(ctx, info, err)
+	}
+}
+
+func (client *StoreEventsPublisher) invokeUpdated(ctx context.Context, req interface{}) (interface{}, error) {
+	var err error
+
+	reqCtx := ctx
+
+	// fire-and-forget calls aren't bound to the deadline of the caller
+	reqMsg := autonats.NewRequestMsg(context.WithoutCancel(reqCtx), client.NatsConn, "autonats.events.StoreEvents.Updated", "jsoniter")
+
+	_, call := autonats.StartProducerCall(reqCtx, reqMsg, "StoreEvents", "Updated")
+	defer func() { call.End(err) }()
+
+	if reqMsg.Data, err = autonats.Encode("jsoniter", req); err != nil {
+		err = autonats.WrapError(autonats.Internal, err)
+		return nil, err
+	}
+
+	if err = client.NatsConn.PublishMsg(reqMsg); err != nil {
+		err = autonats.TransportError(err)
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (client *StoreEventsPublisher) Deleted(ctx context.Context, id string) error {
+	_, err := client.opts.Invoke(ctx, id, &autonats.CallInfo{Service: "StoreEvents", Method: "Deleted", Subject: "autonats.events.StoreEvents.Deleted"}, client.invokeDeleted)
+
+	return err
+}
+
+func (client *StoreEventsPublisher) invokeDeleted(ctx context.Context, req interface{}) (interface{}, error) {
+	var err error
+
+	reqCtx := ctx
+
+	// fire-and-forget calls aren't bound to the deadline of the caller
+	reqMsg := autonats.NewRequestMsg(context.WithoutCancel(reqCtx), client.NatsConn, "autonats.events.StoreEvents.Deleted", "")
+
+	_, call := autonats.StartProducerCall(reqCtx, reqMsg, "StoreEvents", "Deleted")
+	defer func() { call.End(err) }()
+
+	reqMsg.Data = []byte(req.(string))
+
+	if err = client.NatsConn.PublishMsg(reqMsg); err != nil {
+		err = autonats.TransportError(err)
+		return nil, err
+	}
+
+	return nil, nil
+}
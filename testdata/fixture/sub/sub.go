@@ -0,0 +1,5 @@
+package sub
+
+type Label struct {
+	Name string `json:"name"`
+}
@@ -0,0 +1,383 @@
+package autonats
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+type TypeKind int
+
+const (
+	IdentType     TypeKind = iota // Named or builtin type, optionally qualified with a package
+	PointerType                   // *Elem
+	SliceType                     // []Elem
+	ArrayType                     // [Len]Elem
+	MapType                       // map[Key]Elem
+	ChanType                      // chan Elem, <-chan Elem, chan<- Elem
+	FuncType                      // func(Params) Results
+	InterfaceType                 // interface{ Fields }
+	StructType                    // struct{ Fields }
+	EllipsisType                  // ...Elem, only valid as the last param of a func
+)
+
+// Recursive representation of a Go type expression
+type Type struct {
+	Kind    TypeKind
+	Name    string      // Type name for IdentType
+	Package string      // Package qualifier for IdentType
+	Args    []*Type     // Type arguments for an instantiated generic IdentType
+	Len     string      // Length for ArrayType
+	Dir     ast.ChanDir // Channel direction for ChanType
+	Key     *Type       // Key type for MapType
+	Elem    *Type       // Element type for PointerType, SliceType, ArrayType, MapType, ChanType and EllipsisType
+	Params  []*Type     // Params for FuncType
+	Results []*Type     // Results for FuncType
+	Fields  []*TypeField
+}
+
+// Struct field or interface method. Embedded fields have no name.
+type TypeField struct {
+	Name string
+	Type *Type
+	Tag  string
+}
+
+// Converts a type checked Go type into a Type, qualifying named types with q
+func TypeFromGoType(t types.Type, q types.Qualifier) (*Type, error) {
+	switch tt := t.(type) {
+	case *types.Basic:
+		return &Type{Kind: IdentType, Name: tt.Name()}, nil
+
+	case *types.Named:
+		return namedType(tt.Obj(), tt.TypeArgs(), q)
+
+	case *types.Alias:
+		return namedType(tt.Obj(), tt.TypeArgs(), q)
+
+	case *types.TypeParam:
+		return &Type{Kind: IdentType, Name: tt.Obj().Name()}, nil
+
+	case *types.Pointer:
+		return elemType(PointerType, tt.Elem(), q)
+
+	case *types.Slice:
+		return elemType(SliceType, tt.Elem(), q)
+
+	case *types.Array:
+		at, err := elemType(ArrayType, tt.Elem(), q)
+
+		if err != nil {
+			return nil, err
+		}
+
+		at.Len = strconv.FormatInt(tt.Len(), 10)
+
+		return at, nil
+
+	case *types.Map:
+		mt, err := elemType(MapType, tt.Elem(), q)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if mt.Key, err = TypeFromGoType(tt.Key(), q); err != nil {
+			return nil, err
+		}
+
+		return mt, nil
+
+	case *types.Chan:
+		ct, err := elemType(ChanType, tt.Elem(), q)
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch tt.Dir() {
+		case types.SendOnly:
+			ct.Dir = ast.SEND
+		case types.RecvOnly:
+			ct.Dir = ast.RECV
+		default:
+			ct.Dir = ast.SEND | ast.RECV
+		}
+
+		return ct, nil
+
+	case *types.Signature:
+		return signatureType(tt, q)
+
+	case *types.Interface:
+		it := &Type{Kind: InterfaceType}
+
+		for i := 0; i < tt.NumEmbeddeds(); i++ {
+			et, err := TypeFromGoType(tt.EmbeddedType(i), q)
+
+			if err != nil {
+				return nil, err
+			}
+
+			it.Fields = append(it.Fields, &TypeField{Type: et})
+		}
+
+		for i := 0; i < tt.NumExplicitMethods(); i++ {
+			m := tt.ExplicitMethod(i)
+			mt, err := signatureType(m.Type().(*types.Signature), q)
+
+			if err != nil {
+				return nil, err
+			}
+
+			it.Fields = append(it.Fields, &TypeField{Name: m.Name(), Type: mt})
+		}
+
+		return it, nil
+
+	case *types.Struct:
+		st := &Type{Kind: StructType}
+
+		for i := 0; i < tt.NumFields(); i++ {
+			f := tt.Field(i)
+			ft, err := TypeFromGoType(f.Type(), q)
+
+			if err != nil {
+				return nil, err
+			}
+
+			field := &TypeField{Type: ft, Tag: quoteTag(tt.Tag(i))}
+
+			if !f.Embedded() {
+				field.Name = f.Name()
+			}
+
+			st.Fields = append(st.Fields, field)
+		}
+
+		return st, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", types.TypeString(t, q))
+}
+
+func namedType(obj *types.TypeName, args *types.TypeList, q types.Qualifier) (*Type, error) {
+	nt := &Type{Kind: IdentType, Name: obj.Name()}
+
+	if obj.Pkg() != nil && q != nil {
+		nt.Package = q(obj.Pkg())
+	}
+
+	for i := 0; i < args.Len(); i++ {
+		at, err := TypeFromGoType(args.At(i), q)
+
+		if err != nil {
+			return nil, err
+		}
+
+		nt.Args = append(nt.Args, at)
+	}
+
+	return nt, nil
+}
+
+func elemType(kind TypeKind, elem types.Type, q types.Qualifier) (*Type, error) {
+	t, err := TypeFromGoType(elem, q)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Type{Kind: kind, Elem: t}, nil
+}
+
+func signatureType(sig *types.Signature, q types.Qualifier) (*Type, error) {
+	ft := &Type{Kind: FuncType}
+	var err error
+
+	if ft.Params, err = typesFromTuple(sig.Params(), sig.Variadic(), q); err != nil {
+		return nil, err
+	}
+
+	if ft.Results, err = typesFromTuple(sig.Results(), false, q); err != nil {
+		return nil, err
+	}
+
+	return ft, nil
+}
+
+func typesFromTuple(tuple *types.Tuple, variadic bool, q types.Qualifier) ([]*Type, error) {
+	list := make([]*Type, tuple.Len())
+
+	for i := range list {
+		p, err := ParamFromVar(tuple.At(i), variadic && i == len(list)-1, q)
+
+		if err != nil {
+			return nil, err
+		}
+
+		list[i] = p.Type
+	}
+
+	return list, nil
+}
+
+func quoteTag(tag string) string {
+	if tag == "" {
+		return ""
+	}
+
+	if strconv.CanBackquote(tag) {
+		return "`" + tag + "`"
+	}
+
+	return strconv.Quote(tag)
+}
+
+// Renders the type as a Go type expression
+func (t *Type) String() string {
+	var sb strings.Builder
+	t.write(&sb)
+	return sb.String()
+}
+
+func (t *Type) write(sb *strings.Builder) {
+	switch t.Kind {
+	case IdentType:
+		if t.Package != "" {
+			sb.WriteString(t.Package)
+			sb.WriteByte('.')
+		}
+
+		sb.WriteString(t.Name)
+
+		if len(t.Args) > 0 {
+			sb.WriteByte('[')
+			writeTypeList(sb, t.Args)
+			sb.WriteByte(']')
+		}
+
+	case PointerType:
+		sb.WriteByte('*')
+		t.Elem.write(sb)
+
+	case SliceType:
+		sb.WriteString("[]")
+		t.Elem.write(sb)
+
+	case ArrayType:
+		sb.WriteByte('[')
+		sb.WriteString(t.Len)
+		sb.WriteByte(']')
+		t.Elem.write(sb)
+
+	case EllipsisType:
+		sb.WriteString("...")
+		t.Elem.write(sb)
+
+	case MapType:
+		sb.WriteString("map[")
+		t.Key.write(sb)
+		sb.WriteByte(']')
+		t.Elem.write(sb)
+
+	case ChanType:
+		switch t.Dir {
+		case ast.RECV:
+			sb.WriteString("<-chan ")
+		case ast.SEND:
+			sb.WriteString("chan<- ")
+		default:
+			sb.WriteString("chan ")
+		}
+
+		// chan (<-chan T) needs parens to avoid being parsed as chan<- (chan T)
+		if t.Dir == ast.SEND|ast.RECV && t.Elem.Kind == ChanType && t.Elem.Dir == ast.RECV {
+			sb.WriteByte('(')
+			t.Elem.write(sb)
+			sb.WriteByte(')')
+		} else {
+			t.Elem.write(sb)
+		}
+
+	case FuncType:
+		sb.WriteString("func")
+		t.writeSignature(sb)
+
+	case InterfaceType, StructType:
+		if t.Kind == InterfaceType {
+			sb.WriteString("interface{")
+		} else {
+			sb.WriteString("struct{")
+		}
+
+		for i, f := range t.Fields {
+			if i > 0 {
+				sb.WriteString("; ")
+			}
+
+			if f.Name != "" {
+				sb.WriteString(f.Name)
+
+				if t.Kind == InterfaceType {
+					f.Type.writeSignature(sb)
+					continue
+				}
+
+				sb.WriteByte(' ')
+			}
+
+			f.Type.write(sb)
+
+			if f.Tag != "" {
+				sb.WriteByte(' ')
+				sb.WriteString(f.Tag)
+			}
+		}
+
+		sb.WriteByte('}')
+	}
+}
+
+func (t *Type) writeSignature(sb *strings.Builder) {
+	sb.WriteByte('(')
+	writeTypeList(sb, t.Params)
+	sb.WriteByte(')')
+
+	switch len(t.Results) {
+	case 0:
+	case 1:
+		sb.WriteByte(' ')
+		t.Results[0].write(sb)
+	default:
+		sb.WriteString(" (")
+		writeTypeList(sb, t.Results)
+		sb.WriteByte(')')
+	}
+}
+
+func writeTypeList(sb *strings.Builder, list []*Type) {
+	for i, t := range list {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+
+		t.write(sb)
+	}
+}
+
+// Type used to store a value of this type, which turns variadic params into slices
+func (t *Type) Value() *Type {
+	if t.Kind == EllipsisType {
+		return &Type{Kind: SliceType, Elem: t.Elem}
+	}
+
+	return t
+}
+
+// Whether the type is the given builtin (unqualified) type name
+func (t *Type) IsBuiltin(name string) bool {
+	return t.Kind == IdentType && t.Package == "" && len(t.Args) == 0 && t.Name == name
+}